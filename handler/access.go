@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Группы команд, права на которые выдаются ролям целиком
+var commandGroups = []string{"init", "registration", "roles", "stats"}
+
+// Группа, к которой относится команда
+func commandGroup(command string) string {
+	if spec := findCommand(command); spec != nil {
+		return spec.Group
+	}
+	return ""
+}
+
+// Команды группы в порядке регистрации
+func groupCommands(group string) []string {
+	names := []string{}
+	for _, spec := range commandRegistry {
+		if spec.Group == group {
+			names = append(names, spec.key())
+		}
+	}
+	return names
+}
+
+// Является ли имя группой команд
+func isCommandGroup(name string) bool {
+	for _, group := range commandGroups {
+		if group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Приведение команды или группы к ключу настроек: без "!" и в нижнем регистре
+func normalizeCommandName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "!"))
+}
+
+// Является ли имя командой или группой команд, права на которую можно выдать
+func isPermissionTarget(name string) bool {
+	return isCommandGroup(name) || commandGroup(name) != ""
+}
+
+// Роли участника на сервере
+func memberRoleIDs(s *discordgo.Session, guildID, userID string) []string {
+	if member, err := s.State.Member(guildID, userID); err == nil {
+		return member.Roles
+	}
+	member, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		logger.Error("Ошибка получения участника: " + err.Error())
+		return nil
+	}
+	return member.Roles
+}
+
+// Роли, которым разрешена команда: заданные для самой команды и для её группы
+func (sc *ServerConfig) allowedRoles(spec *commandSpec) []string {
+	roles := append([]string{}, sc.CommandPermissions[spec.key()]...)
+	if spec.Group != "" {
+		roles = append(roles, sc.CommandPermissions[spec.Group]...)
+	}
+	return roles
+}
+
+// Разрешена ли команда хотя бы одной из ролей участника
+func (sc *ServerConfig) rolesAllowed(spec *commandSpec, memberRoles []string) bool {
+	for _, allowed := range sc.allowedRoles(spec) {
+		for _, roleID := range memberRoles {
+			if roleID == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Проверка права на команду: администраторам доступно всё,
+// остальным - команды, разрешённые их ролям через !perms
+func commandAllowed(s *discordgo.Session, m *discordgo.MessageCreate, guildID string, spec *commandSpec) bool {
+	if IsAdmin(s, m) {
+		return true
+	}
+	if spec.AdminOnly {
+		return false
+	}
+
+	serverConfig, exists := GetServerConfig(guildID)
+	if !exists || len(serverConfig.CommandPermissions) == 0 {
+		return false
+	}
+	roles := memberRoleIDs(s, guildID, m.Author.ID)
+
+	// Команды без группы (справка) доступны всем, кому разрешена хотя бы одна команда
+	if spec.Group == "" {
+		for _, command := range commandRegistry {
+			if command.Group != "" && serverConfig.rolesAllowed(command, roles) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return serverConfig.rolesAllowed(spec, roles)
+}
+
+// Обработка команд !perms allow, !perms deny и !perms reset
+func (sc *ServerConfig) handlePermsCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	action := call.Path[len(call.Path)-1]
+	target := normalizeCommandName(call.Args[0])
+	if !isPermissionTarget(target) {
+		reply(s, m, fmt.Sprintf("Неизвестная команда или группа `%s`. Группы: %s", target, strings.Join(commandGroups, ", ")))
+		return
+	}
+
+	// Изменения вносятся в копию, чтобы не менять права до сохранения
+	permissions := make(map[string][]string, len(sc.CommandPermissions))
+	for name, roles := range sc.CommandPermissions {
+		permissions[name] = append([]string{}, roles...)
+	}
+
+	var response string
+	switch action {
+	case "allow":
+		roleID := call.Args[1]
+		if findRoleID(s, sc.GuildID, roleID) == "" {
+			reply(s, m, "Роль не найдена на сервере")
+			return
+		}
+		for _, existing := range permissions[target] {
+			if existing == roleID {
+				reply(s, m, fmt.Sprintf("Роли <@&%s> уже разрешено `%s`", roleID, target))
+				return
+			}
+		}
+		permissions[target] = append(permissions[target], roleID)
+		response = fmt.Sprintf("Роли <@&%s> разрешено `%s`", roleID, target)
+
+	case "deny":
+		roleID := call.Args[1]
+		roles := []string{}
+		for _, existing := range permissions[target] {
+			if existing != roleID {
+				roles = append(roles, existing)
+			}
+		}
+		if len(roles) == len(permissions[target]) {
+			reply(s, m, fmt.Sprintf("Роли <@&%s> не было разрешено `%s`", roleID, target))
+			return
+		}
+		permissions[target] = roles
+		response = fmt.Sprintf("Роли <@&%s> запрещено `%s`", roleID, target)
+
+	case "reset":
+		delete(permissions, target)
+		response = fmt.Sprintf("Права на `%s` сброшены: доступно только администраторам", target)
+	}
+
+	if len(permissions[target]) == 0 {
+		delete(permissions, target)
+	}
+	sc.CommandPermissions = permissions
+
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+	reply(s, m, response)
+}
+
+// Показать права на команды
+func (sc *ServerConfig) showCommandPermissions(s *discordgo.Session, m *discordgo.MessageCreate) {
+	response := "**Права на команды** (администраторам доступны все команды):\n"
+	for _, group := range commandGroups {
+		response += fmt.Sprintf("\n`%s` (%s): %s", group, "!"+strings.Join(groupCommands(group), ", !"), formatRoleMentions(sc.CommandPermissions[group]))
+		for _, command := range groupCommands(group) {
+			if roles := sc.CommandPermissions[command]; len(roles) > 0 {
+				response += fmt.Sprintf("\n  `!%s`: %s", command, formatRoleMentions(roles))
+			}
+		}
+	}
+	response += "\n\n`!perms` доступна только администраторам"
+	reply(s, m, response)
+}
+
+// Упоминания ролей через запятую
+func formatRoleMentions(roleIDs []string) string {
+	if len(roleIDs) == 0 {
+		return "только администраторы"
+	}
+	mentions := make([]string, len(roleIDs))
+	for i, roleID := range roleIDs {
+		mentions[i] = "<@&" + roleID + ">"
+	}
+	return strings.Join(mentions, ", ")
+}
+
+// Проверка прав на команды в конфигурации
+func validateCommandPermissions(permissions map[string][]string) error {
+	for name, roles := range permissions {
+		if !isPermissionTarget(name) {
+			return invalidf("command_permissions: неизвестная команда или группа %s", name)
+		}
+		for _, roleID := range roles {
+			if roleID == "" {
+				return invalidf("command_permissions %s: пустой ID роли", name)
+			}
+		}
+	}
+	return nil
+}
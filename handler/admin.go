@@ -0,0 +1,473 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//go:embed web/*.html
+var adminFS embed.FS
+
+// Шаблоны страниц веб-панели
+var adminTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"timestamp": formatTimestamp,
+}).ParseFS(adminFS, "web/*.html"))
+
+// Cookie с идентификатором сессии администратора
+const adminCookieName = "admin_session"
+
+// Время жизни сессии веб-панели
+const adminSessionTTL = 12 * time.Hour
+
+// Сколько записей истории показывать на странице сервера
+const adminHistoryLimit = 50
+
+// Веб-панель администратора
+type adminServer struct {
+	session    *discordgo.Session
+	token      string
+	sessions   map[string]time.Time // идентификатор сессии -> время окончания
+	sessionsMu sync.Mutex
+}
+
+// Подключение веб-панели к HTTP-серверу, если задан ADMIN_TOKEN
+func registerAdminRoutes(mux *http.ServeMux, s *discordgo.Session) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return
+	}
+
+	admin := &adminServer{session: s, token: token, sessions: make(map[string]time.Time)}
+	mux.HandleFunc("/admin/login", admin.handleLogin)
+	mux.HandleFunc("/admin/logout", admin.handleLogout)
+	mux.HandleFunc("/admin/", admin.requireAuth(admin.handleIndex))
+	mux.HandleFunc("/admin/guild", admin.requireAuth(admin.handleGuild))
+	mux.HandleFunc("/admin/guild/config", admin.requireAuth(admin.handleSaveConfig))
+	mux.HandleFunc("/admin/form", admin.requireAuth(admin.handleForm))
+	mux.HandleFunc("/admin/start", admin.requireAuth(admin.handleStart))
+	mux.HandleFunc("/admin/stop", admin.requireAuth(admin.handleStop))
+	mux.HandleFunc("/admin/transcript", admin.requireAuth(admin.handleTranscript))
+	logger.Info("Веб-панель администратора доступна по адресу /admin/")
+}
+
+// Создание сессии со случайным идентификатором. Заодно удаляются истёкшие сессии
+func (a *adminServer) newSession() (string, time.Time, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", time.Time{}, err
+	}
+	id := hex.EncodeToString(buffer)
+	now := time.Now()
+	expires := now.Add(adminSessionTTL)
+
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	for sessionID, sessionExpires := range a.sessions {
+		if now.After(sessionExpires) {
+			delete(a.sessions, sessionID)
+		}
+	}
+	a.sessions[id] = expires
+	return id, expires, nil
+}
+
+// Проверка, что сессия существует и не истекла
+func (a *adminServer) validSession(id string) bool {
+	a.sessionsMu.Lock()
+	defer a.sessionsMu.Unlock()
+	expires, exists := a.sessions[id]
+	if !exists {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(a.sessions, id)
+		return false
+	}
+	return true
+}
+
+// Проверка токена из cookie или заголовка Authorization
+func (a *adminServer) authorized(r *http.Request) bool {
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return subtle.ConstantTimeCompare([]byte(bearer), []byte(a.token)) == 1
+	}
+	cookie, err := r.Cookie(adminCookieName)
+	if err != nil {
+		return false
+	}
+	return a.validSession(cookie.Value)
+}
+
+// Обёртка, требующая авторизации
+func (a *adminServer) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Вход по токену
+func (a *adminServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.render(w, "login.html", map[string]any{})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.FormValue("token")), []byte(a.token)) != 1 {
+		logger.Error("Неудачная попытка входа в веб-панель с адреса " + r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		a.render(w, "login.html", map[string]any{"Error": "Неверный токен"})
+		return
+	}
+
+	id, expires, err := a.newSession()
+	if err != nil {
+		logger.Error("Ошибка создания сессии веб-панели: " + err.Error())
+		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    id,
+		Path:     "/admin/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+// Выход: сессия удаляется на сервере, cookie сбрасывается
+func (a *adminServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(adminCookieName); err == nil {
+		a.sessionsMu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.sessionsMu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    "",
+		Path:     "/admin/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// Запись действия из веб-панели в журнал аудита. before - снимок конфигурации
+// до изменения, nil для действий, не меняющих конфигурацию
+func (a *adminServer) audit(guildID, command, arguments string, before []byte, result string) {
+	after := before
+	if before != nil {
+		after = takeAuditSnapshot(guildID)
+	}
+	recordAudit(a.session, guildID, auditActorWeb, "веб-панель", command, arguments, before, after, result)
+}
+
+// Отрисовка шаблона страницы
+func (a *adminServer) render(w http.ResponseWriter, name string, data map[string]any) {
+	data["LoggedIn"] = name != "login.html"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := adminTemplates.ExecuteTemplate(w, name, data); err != nil {
+		logger.Error("Ошибка отрисовки страницы " + name + ": " + err.Error())
+	}
+}
+
+// Возврат на страницу с сообщением о результате
+func redirectWithMessage(w http.ResponseWriter, r *http.Request, path string, params url.Values, message string, err error) {
+	if err != nil {
+		params.Set("err", err.Error())
+	} else {
+		params.Set("msg", message)
+	}
+	http.Redirect(w, r, path+"?"+params.Encode(), http.StatusSeeOther)
+}
+
+// Сервер из параметра запроса
+func (a *adminServer) guildConfig(w http.ResponseWriter, r *http.Request) (*ServerConfig, bool) {
+	serverConfig, exists := GetServerConfig(r.FormValue("guild"))
+	if !exists {
+		http.Error(w, "Сервер не найден", http.StatusNotFound)
+	}
+	return serverConfig, exists
+}
+
+// Название сервера из кеша Discord
+func (a *adminServer) guildName(guildID string) string {
+	if guild, err := a.session.State.Guild(guildID); err == nil {
+		return guild.Name
+	}
+	return guildID
+}
+
+// Список серверов
+func (a *adminServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type guildRow struct {
+		ID       string
+		Name     string
+		Sessions int
+		Queue    int
+	}
+
+	guildIDs := []string{}
+	ForEachServerConfig(func(guildID string, config *ServerConfig) {
+		guildIDs = append(guildIDs, guildID)
+	})
+	sort.Strings(guildIDs)
+
+	guilds := []guildRow{}
+	for _, guildID := range guildIDs {
+		guilds = append(guilds, guildRow{
+			ID:       guildID,
+			Name:     a.guildName(guildID),
+			Sessions: countGuildSessions(guildID),
+			Queue:    queueLength(guildID),
+		})
+	}
+
+	a.render(w, "index.html", map[string]any{"Guilds": guilds})
+}
+
+// Страница сервера: конфигурация, формы, активные сессии и история
+func (a *adminServer) handleGuild(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	configJSON, _ := json.MarshalIndent(serverConfig, "", "  ")
+
+	history, err := loadRegistrationHistory(serverConfig.GuildID, historyFilter{Limit: adminHistoryLimit})
+	if err != nil {
+		logger.Error("Ошибка загрузки истории регистраций: " + err.Error())
+	}
+
+	a.render(w, "guild.html", map[string]any{
+		"Guild":    serverConfig.GuildID,
+		"Name":     a.guildName(serverConfig.GuildID),
+		"Config":   string(configJSON),
+		"Forms":    ListRegistrationForms(serverConfig.GuildID),
+		"Sessions": guildSessions(serverConfig.GuildID),
+		"Queue":    queueLength(serverConfig.GuildID),
+		"History":  history,
+		"Message":  r.FormValue("msg"),
+		"Error":    r.FormValue("err"),
+	})
+}
+
+// Сохранение конфигурации сервера
+func (a *adminServer) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+	params := url.Values{"guild": {serverConfig.GuildID}}
+
+	var loadedConfig ServerConfig
+	if err := json.Unmarshal([]byte(r.FormValue("config")), &loadedConfig); err != nil {
+		redirectWithMessage(w, r, "/admin/guild", params, "", err)
+		return
+	}
+
+	// Сервер нельзя переименовать из панели
+	loadedConfig.GuildID = serverConfig.GuildID
+	before := takeAuditSnapshot(serverConfig.GuildID)
+	updated, err := updateServerConfig(serverConfig, &loadedConfig, true)
+	a.audit(serverConfig.GuildID, "config", "", before, auditResult("Конфигурация сервера сохранена", err))
+	if err != nil {
+		logger.Error("Ошибка сохранения конфигурации сервера: " + err.Error())
+		redirectWithMessage(w, r, "/admin/guild", params, "", err)
+		return
+	}
+	if err := updated.refreshPanel(a.session); err != nil {
+		logger.Error("Ошибка обновления панели регистрации: " + err.Error())
+	}
+
+	logger.Info("ServerConfig изменён через веб-панель для сервера: " + updated.GuildID)
+	redirectWithMessage(w, r, "/admin/guild", params, "Конфигурация сервера сохранена", nil)
+}
+
+// Просмотр и редактирование формы регистрации
+func (a *adminServer) handleForm(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+	name := normalizeFormName(r.FormValue("name"))
+
+	if r.Method == http.MethodPost {
+		params := url.Values{"guild": {serverConfig.GuildID}, "name": {name}}
+
+		var form RegistrationConfig
+		if err := json.Unmarshal([]byte(r.FormValue("config")), &form); err != nil {
+			redirectWithMessage(w, r, "/admin/form", params, "", err)
+			return
+		}
+		form.Name = name
+		before := takeAuditSnapshot(serverConfig.GuildID)
+		err := updateRegistrationForm(serverConfig.GuildID, &form)
+		a.audit(serverConfig.GuildID, "form", name, before, auditResult("Форма сохранена", err))
+		if err != nil {
+			logger.Error("Ошибка сохранения формы: " + err.Error())
+			redirectWithMessage(w, r, "/admin/form", params, "", err)
+			return
+		}
+		if err := serverConfig.refreshPanel(a.session); err != nil {
+			logger.Error("Ошибка обновления панели регистрации: " + err.Error())
+		}
+
+		logger.Info("Форма " + name + " изменена через веб-панель для сервера: " + serverConfig.GuildID)
+		redirectWithMessage(w, r, "/admin/form", params, "Форма сохранена", nil)
+		return
+	}
+
+	form, exists := GetRegistrationForm(serverConfig.GuildID, name)
+	if !exists {
+		form = &RegistrationConfig{Name: name, Version: "1.0", Questions: []Question{}}
+	}
+	formJSON, _ := json.MarshalIndent(form, "", "  ")
+
+	a.render(w, "form.html", map[string]any{
+		"Guild":   serverConfig.GuildID,
+		"Name":    name,
+		"New":     !exists,
+		"Config":  string(formJSON),
+		"Message": r.FormValue("msg"),
+		"Error":   r.FormValue("err"),
+	})
+}
+
+// Запуск регистрации участника или всех незарегистрированных
+func (a *adminServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+	params := url.Values{"guild": {serverConfig.GuildID}}
+
+	formName := normalizeFormName(r.FormValue("form"))
+	if _, exists := GetRegistrationForm(serverConfig.GuildID, formName); !exists {
+		redirectWithMessage(w, r, "/admin/guild", params, "", fmt.Errorf("Форма регистрации %s не найдена", formName))
+		return
+	}
+
+	userID := parseUserID(strings.TrimSpace(r.FormValue("user_id")))
+	if userID == "" {
+		a.audit(serverConfig.GuildID, "start", "--all --form "+formName, nil, "Запуск регистрации для пользователей без роли начат")
+		// Постановка в очередь идёт с задержками, не задерживаем ответ
+		go func() {
+			count, err := serverConfig.registerUnregisteredMembers(a.session, formName, "")
+			if err != nil {
+				logger.Error("Ошибка запуска регистрации из веб-панели: " + err.Error())
+				return
+			}
+			logger.Info("Из веб-панели запущена регистрация для " + strconv.Itoa(count) + " пользователей")
+		}()
+		redirectWithMessage(w, r, "/admin/guild", params, "Запуск регистрации для пользователей без роли начат", nil)
+		return
+	}
+
+	err := serverConfig.registerMember(a.session, userID, formName, "")
+	a.audit(serverConfig.GuildID, "start", userID+" --form "+formName, nil, auditResult("Запущена регистрация для пользователя "+userID, err))
+	redirectWithMessage(w, r, "/admin/guild", params, "Запущена регистрация для пользователя "+userID, err)
+}
+
+// Прерывание регистрации участника или всех регистраций сервера
+func (a *adminServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+	params := url.Values{"guild": {serverConfig.GuildID}}
+
+	userID := parseUserID(strings.TrimSpace(r.FormValue("user_id")))
+	if userID == "" {
+		count, dequeued := serverConfig.stopGuildRegistrations(a.session)
+		result := "Прервано регистраций: " + strconv.Itoa(count) + ", удалено из очереди: " + strconv.Itoa(dequeued)
+		a.audit(serverConfig.GuildID, "stop", "--all", nil, result)
+		redirectWithMessage(w, r, "/admin/guild", params, result, nil)
+		return
+	}
+
+	result, err := serverConfig.stopMemberRegistration(a.session, userID)
+	a.audit(serverConfig.GuildID, "stop", userID, nil, auditResult(result, err))
+	redirectWithMessage(w, r, "/admin/guild", params, result, err)
+}
+
+// Просмотр ответов завершённой или прерванной сессии
+func (a *adminServer) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID записи", http.StatusBadRequest)
+		return
+	}
+	entry, err := loadHistoryEntry(serverConfig.GuildID, id)
+	if err != nil {
+		logger.Error("Ошибка загрузки истории регистраций: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	form, _ := GetRegistrationForm(serverConfig.GuildID, entry.Session.FormName)
+	a.render(w, "transcript.html", map[string]any{
+		"Guild":   serverConfig.GuildID,
+		"Entry":   entry,
+		"Form":    normalizeFormName(entry.Session.FormName),
+		"Answers": orderedAnswers(entry.Session.Answers, form),
+		"Data":    entry.Session.Data,
+	})
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Announcement - объявление о новом участнике после завершения регистрации
+type Announcement struct {
+	ChannelID  string             `json:"channel_id"`
+	Message    string             `json:"message,omitempty"`
+	Embed      *AnnouncementEmbed `json:"embed,omitempty"`
+	PingRoleID string             `json:"ping_role_id,omitempty"`
+	When       *ConditionCheck    `json:"when,omitempty"` // объявление отправляется, только если условие выполнено
+}
+
+// AnnouncementEmbed - оформление объявления
+type AnnouncementEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       string `json:"color,omitempty"` // #RRGGBB
+	Image       string `json:"image,omitempty"`
+	Thumbnail   string `json:"thumbnail,omitempty"`
+}
+
+// Отправка объявлений о завершении регистрации, подходящих под ответы участника
+func (sc *ServerConfig) sendAnnouncements(s *discordgo.Session, session *UserSession, regConfig *RegistrationConfig) {
+	if len(regConfig.Completion.Announcements) == 0 {
+		return
+	}
+
+	member, err := s.GuildMember(sc.GuildID, session.UserID)
+	if err != nil {
+		logger.Error("Ошибка получения участника для объявления: " + err.Error())
+		member = &discordgo.Member{User: &discordgo.User{ID: session.UserID}}
+	}
+
+	for _, announcement := range regConfig.Completion.Announcements {
+		if announcement.When != nil && !sc.checkCondition(*announcement.When, session) {
+			continue
+		}
+		if err := sc.sendAnnouncement(s, announcement, session, member, regConfig); err != nil {
+			logger.Error("Ошибка отправки объявления в канал " + announcement.ChannelID + ": " + err.Error())
+		}
+	}
+}
+
+// Отправка одного объявления
+func (sc *ServerConfig) sendAnnouncement(s *discordgo.Session, announcement Announcement, session *UserSession, member *discordgo.Member, regConfig *RegistrationConfig) error {
+	render := func(text string) string {
+		return sc.announcementTemplate(text, session, member, regConfig)
+	}
+
+	message := &discordgo.MessageSend{
+		Content: render(announcement.Message),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Users: []string{session.UserID},
+		},
+	}
+
+	if announcement.PingRoleID != "" {
+		if roleID := findRoleID(s, sc.GuildID, announcement.PingRoleID); roleID != "" {
+			message.Content = strings.TrimSpace("<@&" + roleID + "> " + message.Content)
+			message.AllowedMentions.Roles = []string{roleID}
+		} else {
+			logger.Error("Роль для упоминания в объявлении не найдена: " + announcement.PingRoleID)
+		}
+	}
+
+	if embed := announcement.Embed; embed != nil {
+		message.Embed = &discordgo.MessageEmbed{
+			Title:       render(embed.Title),
+			Description: render(embed.Description),
+			Color:       defaultQuestionColor,
+		}
+		if embed.Color != "" {
+			if color, err := parseColor(embed.Color); err == nil {
+				message.Embed.Color = color
+			}
+		}
+		if embed.Image != "" {
+			message.Embed.Image = &discordgo.MessageEmbedImage{URL: render(embed.Image)}
+		}
+		if embed.Thumbnail != "" {
+			message.Embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: render(embed.Thumbnail)}
+		} else if member.User.Username != "" {
+			// По умолчанию - аватар нового участника
+			message.Embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: member.User.AvatarURL("128")}
+		}
+	}
+
+	_, err := s.ChannelMessageSendComplex(parseChannelID(announcement.ChannelID), message)
+	return err
+}
+
+// Подстановка переменных объявления: участник, ответы, сохранённые поля и профиль
+func (sc *ServerConfig) announcementTemplate(text string, session *UserSession, member *discordgo.Member, regConfig *RegistrationConfig) string {
+	if text == "" {
+		return ""
+	}
+
+	nickname := member.Nick
+	if nickname == "" {
+		nickname = member.User.GlobalName
+	}
+	if nickname == "" {
+		nickname = member.User.Username
+	}
+
+	replacements := []string{
+		"{mention}", "<@" + session.UserID + ">",
+		"{user_id}", session.UserID,
+		"{username}", member.User.Username,
+		"{nickname}", nickname,
+		"{form}", regConfig.DisplayTitle(),
+	}
+	for questionID, answer := range session.Answers {
+		replacements = append(replacements, "{answer."+questionID+"}", formatAnswer(answer))
+	}
+	text = strings.NewReplacer(replacements...).Replace(text)
+
+	return sc.resolveTemplate(text, nil, session)
+}
+
+// Получение ID канала из упоминания
+func parseChannelID(arg string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(arg, "<#"), ">")
+}
+
+// Проверка условия: поле, поддерживаемый оператор и строковое значение
+func validateCondition(check ConditionCheck) error {
+	if check.Field == "" {
+		return invalidf("не указан field")
+	}
+	switch check.Operator {
+	case "equals", "not_equals", "contains":
+	default:
+		return invalidf("неизвестный оператор %q", check.Operator)
+	}
+	if _, ok := check.Value.(string); !ok {
+		return invalidf("value должно быть строкой")
+	}
+	return nil
+}
+
+// Проверка объявлений формы
+func validateAnnouncements(announcements []Announcement) error {
+	for i, announcement := range announcements {
+		if announcement.ChannelID == "" {
+			return invalidf("completion.announcements[%d]: не указан channel_id", i)
+		}
+		if announcement.Message == "" && announcement.Embed == nil {
+			return invalidf("completion.announcements[%d]: нужен message или embed", i)
+		}
+		if announcement.When != nil {
+			if err := validateCondition(*announcement.When); err != nil {
+				return invalidf("completion.announcements[%d].when: %v", i, err)
+			}
+		}
+		if announcement.Embed != nil && announcement.Embed.Color != "" {
+			if _, err := parseColor(announcement.Embed.Color); err != nil {
+				return invalidf("completion.announcements[%d]: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
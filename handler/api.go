@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Ограничения выдачи истории регистраций в API
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+	apiMaxBodySize  = 1 << 20 // 1 МБ на тело запроса
+)
+
+// JSON API для скриптов
+type apiServer struct {
+	session *discordgo.Session
+	token   string
+}
+
+// Подключение API v1 к HTTP-серверу, если задан API_TOKEN
+func registerAPIRoutes(mux *http.ServeMux, s *discordgo.Session) {
+	token := os.Getenv("API_TOKEN")
+	if token == "" {
+		return
+	}
+
+	api := &apiServer{session: s, token: token}
+	mux.HandleFunc("GET /api/v1/guilds", api.requireAuth(api.handleListGuilds))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/config", api.requireAuth(api.handleGetConfig))
+	mux.HandleFunc("PUT /api/v1/guilds/{guild}/config", api.requireAuth(api.handlePutConfig))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/forms", api.requireAuth(api.handleListForms))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/forms/{form}", api.requireAuth(api.handleGetForm))
+	mux.HandleFunc("PUT /api/v1/guilds/{guild}/forms/{form}", api.requireAuth(api.handlePutForm))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/sessions", api.requireAuth(api.handleListSessions))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/sessions/{user}", api.requireAuth(api.handleGetSession))
+	mux.HandleFunc("DELETE /api/v1/guilds/{guild}/sessions/{user}", api.requireAuth(api.handleCancelSession))
+	mux.HandleFunc("GET /api/v1/guilds/{guild}/registrations", api.requireAuth(api.handleListRegistrations))
+	mux.HandleFunc("POST /api/v1/guilds/{guild}/registrations", api.requireAuth(api.handleStartRegistration))
+	logger.Info("JSON API доступно по адресу /api/v1/")
+}
+
+// Обёртка, требующая заголовок Authorization: Bearer <API_TOKEN>
+func (a *apiServer) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "неверный токен")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Запись действия через API в журнал аудита. before - снимок конфигурации
+// до изменения, nil для действий, не меняющих конфигурацию
+func (a *apiServer) audit(guildID, command, arguments string, before []byte, result string) {
+	after := before
+	if before != nil {
+		after = takeAuditSnapshot(guildID)
+	}
+	recordAudit(a.session, guildID, auditActorAPI, "API", command, arguments, before, after, result)
+}
+
+// Ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Ошибка отправки ответа API: " + err.Error())
+	}
+}
+
+// Ответ с ошибкой в формате JSON
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Чтение JSON из тела запроса с ограничением размера
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, value any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, apiMaxBodySize)
+	return json.NewDecoder(r.Body).Decode(value)
+}
+
+// Ответ с ошибкой сохранения: 400 для ошибок проверки, 500 для остальных
+func writeSaveError(w http.ResponseWriter, err error) {
+	if isValidationError(err) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	logger.Error("Ошибка сохранения в БД: " + err.Error())
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
+
+// Ответ с ошибкой запуска регистрации: 404 - участника нет на сервере,
+// 409 - регистрация невозможна, 502 - ошибка Discord, 500 для остальных
+func writeRegisterError(w http.ResponseWriter, err error) {
+	switch registerErrorReason(err) {
+	case registerNotFound:
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case registerConflict:
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case registerDiscord:
+		logger.Error("Ошибка Discord при запуске регистрации: " + err.Error())
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+	default:
+		logger.Error("Ошибка запуска регистрации: " + err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Сервер из пути запроса
+func (a *apiServer) guildConfig(w http.ResponseWriter, r *http.Request) (*ServerConfig, bool) {
+	serverConfig, exists := GetServerConfig(r.PathValue("guild"))
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "сервер не найден")
+	}
+	return serverConfig, exists
+}
+
+// GET /api/v1/guilds
+func (a *apiServer) handleListGuilds(w http.ResponseWriter, r *http.Request) {
+	guildIDs := []string{}
+	ForEachServerConfig(func(guildID string, config *ServerConfig) {
+		guildIDs = append(guildIDs, guildID)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"guilds": guildIDs})
+}
+
+// GET /api/v1/guilds/{guild}/config
+func (a *apiServer) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	if serverConfig, exists := a.guildConfig(w, r); exists {
+		writeJSON(w, http.StatusOK, serverConfig)
+	}
+}
+
+// PUT /api/v1/guilds/{guild}/config
+func (a *apiServer) handlePutConfig(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	var loadedConfig ServerConfig
+	if err := decodeJSONBody(w, r, &loadedConfig); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "ошибка парсинга JSON: "+err.Error())
+		return
+	}
+	if loadedConfig.GuildID != "" && loadedConfig.GuildID != serverConfig.GuildID {
+		writeJSONError(w, http.StatusBadRequest, "guild_id не совпадает с сервером в пути")
+		return
+	}
+	loadedConfig.GuildID = serverConfig.GuildID
+
+	before := takeAuditSnapshot(serverConfig.GuildID)
+	updated, err := updateServerConfig(serverConfig, &loadedConfig, true)
+	a.audit(serverConfig.GuildID, "config", "", before, auditResult("Конфигурация сервера сохранена", err))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	if err := updated.refreshPanel(a.session); err != nil {
+		logger.Error("Ошибка обновления панели регистрации: " + err.Error())
+	}
+
+	logger.Info("ServerConfig изменён через API для сервера: " + updated.GuildID)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// GET /api/v1/guilds/{guild}/forms
+func (a *apiServer) handleListForms(w http.ResponseWriter, r *http.Request) {
+	if serverConfig, exists := a.guildConfig(w, r); exists {
+		writeJSON(w, http.StatusOK, map[string]any{"forms": ListRegistrationForms(serverConfig.GuildID)})
+	}
+}
+
+// GET /api/v1/guilds/{guild}/forms/{form}
+func (a *apiServer) handleGetForm(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	form, exists := GetRegistrationForm(serverConfig.GuildID, r.PathValue("form"))
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "форма не найдена")
+		return
+	}
+	writeJSON(w, http.StatusOK, form)
+}
+
+// PUT /api/v1/guilds/{guild}/forms/{form}
+func (a *apiServer) handlePutForm(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	var form RegistrationConfig
+	if err := decodeJSONBody(w, r, &form); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "ошибка парсинга JSON: "+err.Error())
+		return
+	}
+	form.Name = normalizeFormName(r.PathValue("form"))
+
+	before := takeAuditSnapshot(serverConfig.GuildID)
+	err := updateRegistrationForm(serverConfig.GuildID, &form)
+	a.audit(serverConfig.GuildID, "form", form.Name, before, auditResult("Форма сохранена", err))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	if err := serverConfig.refreshPanel(a.session); err != nil {
+		logger.Error("Ошибка обновления панели регистрации: " + err.Error())
+	}
+
+	logger.Info("Форма " + form.Name + " изменена через API для сервера: " + serverConfig.GuildID)
+	writeJSON(w, http.StatusOK, form)
+}
+
+// GET /api/v1/guilds/{guild}/sessions
+func (a *apiServer) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	if serverConfig, exists := a.guildConfig(w, r); exists {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"sessions": guildSessions(serverConfig.GuildID),
+			"queue":    queuedUserIDs(serverConfig.GuildID),
+		})
+	}
+}
+
+// GET /api/v1/guilds/{guild}/sessions/{user}
+func (a *apiServer) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	userID := r.PathValue("user")
+	for _, session := range guildSessions(serverConfig.GuildID) {
+		if session.UserID == userID {
+			writeJSON(w, http.StatusOK, session)
+			return
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, "пользователь не проходит регистрацию")
+}
+
+// DELETE /api/v1/guilds/{guild}/sessions/{user}
+func (a *apiServer) handleCancelSession(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	userID := r.PathValue("user")
+	registering := false
+	for _, session := range guildSessions(serverConfig.GuildID) {
+		registering = registering || session.UserID == userID
+	}
+	for _, queuedID := range queuedUserIDs(serverConfig.GuildID) {
+		registering = registering || queuedID == userID
+	}
+	if !registering {
+		writeJSONError(w, http.StatusNotFound, "пользователь не проходит регистрацию")
+		return
+	}
+
+	result, err := serverConfig.stopMemberRegistration(a.session, userID)
+	a.audit(serverConfig.GuildID, "stop", userID, nil, auditResult(result, err))
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"result": result})
+}
+
+// GET /api/v1/guilds/{guild}/registrations?outcome=completed&user_id=ID&since=YYYY-MM-DD&limit=N
+func (a *apiServer) handleListRegistrations(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := historyFilter{
+		UserID:  query.Get("user_id"),
+		Outcome: query.Get("outcome"),
+		Limit:   apiDefaultLimit,
+	}
+	if filter.Outcome == "" {
+		filter.Outcome = OutcomeCompleted
+	}
+	if since := query.Get("since"); since != "" {
+		date, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "since должен быть в формате YYYY-MM-DD")
+			return
+		}
+		filter.Since = date.Unix()
+	}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 || value > apiMaxLimit {
+			writeJSONError(w, http.StatusBadRequest, "limit должен быть от 1 до "+strconv.Itoa(apiMaxLimit))
+			return
+		}
+		filter.Limit = value
+	}
+
+	entries, err := loadRegistrationHistory(serverConfig.GuildID, filter)
+	if err != nil {
+		logger.Error("Ошибка загрузки истории регистраций: " + err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	registrations := make([]map[string]any, 0, len(entries))
+	for _, entry := range entries {
+		registrations = append(registrations, map[string]any{
+			"id":          entry.ID,
+			"user_id":     entry.UserID,
+			"form":        normalizeFormName(entry.Session.FormName),
+			"outcome":     entry.Outcome,
+			"reviewer_id": entry.Session.ReviewerID,
+			"started_at":  entry.StartedAt,
+			"finished_at": entry.FinishedAt,
+			"answers":     entry.Session.Answers,
+			"data":        entry.Session.Data,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"registrations": registrations})
+}
+
+// POST /api/v1/guilds/{guild}/registrations {"user_id": "...", "form": "..."}
+func (a *apiServer) handleStartRegistration(w http.ResponseWriter, r *http.Request) {
+	serverConfig, exists := a.guildConfig(w, r)
+	if !exists {
+		return
+	}
+
+	var request struct {
+		UserID string `json:"user_id"`
+		Form   string `json:"form"`
+	}
+	if err := decodeJSONBody(w, r, &request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "ошибка парсинга JSON: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "не указан user_id")
+		return
+	}
+
+	formName := normalizeFormName(request.Form)
+	if _, exists := GetRegistrationForm(serverConfig.GuildID, formName); !exists {
+		writeJSONError(w, http.StatusNotFound, "форма регистрации "+formName+" не найдена")
+		return
+	}
+
+	err := serverConfig.registerMember(a.session, parseUserID(request.UserID), formName, "")
+	a.audit(serverConfig.GuildID, "start", request.UserID+" --form "+formName, nil,
+		auditResult("Запущена регистрация для пользователя "+request.UserID, err))
+	if err != nil {
+		writeRegisterError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"user_id": request.UserID,
+		"form":    formName,
+		"queue":   queueLength(serverConfig.GuildID),
+	})
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Цвет вопросов по умолчанию
+const defaultQuestionColor = 0x5865F2
+
+// Appearance - оформление вопросов: на уровне формы и с переопределением в вопросе
+type Appearance struct {
+	Title        string `json:"title,omitempty"`
+	Color        string `json:"color,omitempty"`     // #RRGGBB
+	Image        string `json:"image,omitempty"`     // URL картинки под вопросом
+	Thumbnail    string `json:"thumbnail,omitempty"` // URL миниатюры справа
+	HideProgress bool   `json:"hide_progress,omitempty"`
+}
+
+// Разбор цвета вида #RRGGBB
+func parseColor(value string) (int, error) {
+	color, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(value), "#"), 16, 32)
+	if err != nil || color < 0 || color > 0xFFFFFF {
+		return 0, fmt.Errorf("неверный цвет %q, ожидается #RRGGBB", value)
+	}
+	return int(color), nil
+}
+
+// Оформление вопроса: поля вопроса переопределяют поля формы
+func (rc *RegistrationConfig) questionAppearance(question *Question) Appearance {
+	appearance := Appearance{}
+	if rc.Appearance != nil {
+		appearance = *rc.Appearance
+	}
+	if override := question.Appearance; override != nil {
+		if override.Title != "" {
+			appearance.Title = override.Title
+		}
+		if override.Color != "" {
+			appearance.Color = override.Color
+		}
+		if override.Image != "" {
+			appearance.Image = override.Image
+		}
+		if override.Thumbnail != "" {
+			appearance.Thumbnail = override.Thumbnail
+		}
+		appearance.HideProgress = appearance.HideProgress || override.HideProgress
+	}
+	return appearance
+}
+
+// Вопросы, на которые можно перейти после ответа на вопрос
+func nextQuestionIDs(question *Question) []string {
+	ids := []string{}
+	switch question.Next.Type {
+	case "static":
+		ids = append(ids, question.Next.QuestionID)
+	case "conditional":
+		for _, condition := range question.Next.Conditions {
+			ids = append(ids, condition.QuestionID)
+		}
+		ids = append(ids, question.Next.Default)
+	}
+	return ids
+}
+
+// Длина самого длинного пути от вопроса до конца регистрации, включая сам вопрос
+func (rc *RegistrationConfig) longestPath(questionID string) int {
+	questions := make(map[string]*Question, len(rc.Questions))
+	for i := range rc.Questions {
+		questions[rc.Questions[i].ID] = &rc.Questions[i]
+	}
+
+	lengths := make(map[string]int)
+	visiting := make(map[string]bool)
+	// walk возвращает длину пути и признак того, что путь оборван циклом
+	var walk func(id string) (int, bool)
+	walk = func(id string) (int, bool) {
+		question, exists := questions[id]
+		if !exists {
+			return 0, false
+		}
+		// Циклы в графе вопросов не увеличивают длину пути
+		if visiting[id] {
+			return 0, true
+		}
+		if length, known := lengths[id]; known {
+			return length, false
+		}
+
+		visiting[id] = true
+		longest, truncated := 0, false
+		for _, next := range nextQuestionIDs(question) {
+			length, cut := walk(next)
+			longest = max(longest, length)
+			truncated = truncated || cut
+		}
+		visiting[id] = false
+
+		// Оборванный циклом результат зависит от начала обхода, его не запоминаем
+		if !truncated {
+			lengths[id] = longest + 1
+		}
+		return longest + 1, truncated
+	}
+	length, _ := walk(questionID)
+	return length
+}
+
+// Сообщение с вопросом в виде embed
+func (rc *RegistrationConfig) questionEmbed(question *Question, session *UserSession) *discordgo.MessageEmbed {
+	appearance := rc.questionAppearance(question)
+
+	description := question.Text
+	if question.Type == "single_choice" || question.Type == "multiple_choice" {
+		description += "\n\n**Варианты ответа:**"
+		for _, option := range question.Options {
+			description += fmt.Sprintf("\n`%s` - %s", option.ID, option.Text)
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       appearance.Title,
+		Description: description,
+		Color:       defaultQuestionColor,
+	}
+	if embed.Title == "" {
+		embed.Title = rc.Title
+	}
+	if embed.Title == "" {
+		embed.Title = "Регистрация"
+	}
+	if appearance.Color != "" {
+		if color, err := parseColor(appearance.Color); err == nil {
+			embed.Color = color
+		}
+	}
+	if appearance.Image != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: appearance.Image}
+	}
+	if appearance.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: appearance.Thumbnail}
+	}
+
+	if !appearance.HideProgress {
+		// Уже отвеченные вопросы плюс самый длинный оставшийся путь
+		answered := len(session.Answers)
+		total := answered + rc.longestPath(question.ID)
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Вопрос %d из %d", answered+1, total),
+		}
+	}
+
+	return embed
+}
+
+// Проверка оформления формы или вопроса
+func validateAppearance(appearance *Appearance) error {
+	if appearance == nil || appearance.Color == "" {
+		return nil
+	}
+	if _, err := parseColor(appearance.Color); err != nil {
+		return invalidf("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Политики обращения с каналом завершённой регистрации
+const (
+	ChannelPolicyDelete  = "delete"  // удалить через channel_delete_delay секунд (по умолчанию)
+	ChannelPolicyArchive = "archive" // перенести в архивную категорию только для чтения
+	ChannelPolicyKeep    = "keep"    // оставить канал как есть
+)
+
+const defaultChannelDeleteDelay = 30 * time.Second
+
+// Проверка корректности политики канала
+func isValidChannelPolicy(policy string) bool {
+	switch policy {
+	case ChannelPolicyDelete, ChannelPolicyArchive, ChannelPolicyKeep:
+		return true
+	}
+	return false
+}
+
+// Политика канала с учётом значения по умолчанию
+func (sc *ServerConfig) channelPolicy() string {
+	if sc.ChannelPolicy == "" {
+		return ChannelPolicyDelete
+	}
+	return sc.ChannelPolicy
+}
+
+// Задержка перед закрытием канала завершённой регистрации
+func (sc *ServerConfig) channelCloseDelay() time.Duration {
+	if sc.ChannelDeleteDelay > 0 {
+		return time.Duration(sc.ChannelDeleteDelay) * time.Second
+	}
+	return defaultChannelDeleteDelay
+}
+
+// Планирование закрытия канала после завершения регистрации
+func (sc *ServerConfig) scheduleChannelClose(s *discordgo.Session, userID, channelID string) {
+	if sc.channelPolicy() == ChannelPolicyKeep {
+		return
+	}
+
+	task := &scheduledTask{
+		GuildID:   sc.GuildID,
+		UserID:    userID,
+		ChannelID: channelID,
+		Action:    taskCloseChannel,
+		RunAt:     time.Now().Add(sc.channelCloseDelay()).Unix(),
+	}
+	if err := scheduleTask(s, task); err != nil {
+		logger.Error("Ошибка планирования закрытия канала " + channelID + ": " + err.Error())
+	}
+}
+
+// Закрытие канала регистрации по политике сервера
+func (sc *ServerConfig) closeRegistrationChannel(s *discordgo.Session, channelID, userID string) {
+	switch sc.channelPolicy() {
+	case ChannelPolicyKeep:
+		return
+
+	case ChannelPolicyArchive:
+		// Без архивной категории канал остаётся на месте, чтобы не потерять переписку
+		if sc.ArchiveCategoryID == "" {
+			logger.Error("Архивная категория не задана, канал " + channelID + " оставлен без изменений")
+			return
+		}
+		if err := sc.archiveChannel(s, channelID, userID); err != nil {
+			logger.Error("Ошибка архивации канала " + channelID + ": " + err.Error())
+		}
+		return
+	}
+
+	if _, err := s.ChannelDelete(channelID); err != nil {
+		logger.Error("Ошибка удаления канала " + channelID + ": " + err.Error())
+	}
+}
+
+// Перенос канала в архивную категорию и запрет участнику писать в нём
+func (sc *ServerConfig) archiveChannel(s *discordgo.Session, channelID, userID string) error {
+	_, err := s.ChannelEdit(channelID, &discordgo.ChannelEdit{ParentID: sc.ArchiveCategoryID})
+	if err != nil {
+		return err
+	}
+
+	// Участник может только читать свой канал. Если он уже покинул сервер, права не нужны
+	err = s.ChannelPermissionSet(channelID, userID, discordgo.PermissionOverwriteTypeMember,
+		discordgo.PermissionViewChannel|discordgo.PermissionReadMessageHistory,
+		allChannelPermissions()&^(discordgo.PermissionViewChannel|discordgo.PermissionReadMessageHistory))
+	if err != nil {
+		logger.Error("Ошибка изменения прав в архивном канале " + channelID + ": " + err.Error())
+	}
+
+	logger.Info("Канал " + channelID + " перенесён в архив")
+
+	if sc.ArchiveRetentionDays <= 0 {
+		return nil
+	}
+
+	return scheduleTask(s, &scheduledTask{
+		GuildID:   sc.GuildID,
+		UserID:    userID,
+		ChannelID: channelID,
+		Action:    taskDeleteChannel,
+		RunAt:     time.Now().AddDate(0, 0, sc.ArchiveRetentionDays).Unix(),
+	})
+}
@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Количество записей журнала на одной странице
+const auditPageSize = 10
+
+// Максимальная длина результата команды в журнале
+const maxAuditResultLength = 1000
+
+// Участники журнала аудита, не являющиеся пользователями Discord
+const (
+	auditActorWeb = "web" // веб-панель администратора
+	auditActorAPI = "api" // JSON API
+)
+
+// Запись журнала аудита
+type auditEntry struct {
+	ID           int64
+	GuildID      string
+	ActorID      string
+	ActorName    string
+	Command      string
+	Arguments    string
+	ConfigBefore string
+	ConfigAfter  string
+	Result       string
+	CreatedAt    int64
+}
+
+// Снимок конфигурации сервера и форм для сравнения до и после команды
+type auditSnapshot struct {
+	Server *ServerConfig                  `json:"server,omitempty"`
+	Forms  map[string]*RegistrationConfig `json:"forms,omitempty"`
+}
+
+// Снимок текущей конфигурации сервера в JSON.
+// Сериализуется сразу, потому что команды изменяют конфигурацию на месте
+func takeAuditSnapshot(guildID string) []byte {
+	snapshot := auditSnapshot{Forms: make(map[string]*RegistrationConfig)}
+	snapshot.Server, _ = GetServerConfig(guildID)
+	for _, form := range ListRegistrationForms(guildID) {
+		snapshot.Forms[form.FormName()] = form
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.Error("Ошибка сохранения снимка конфигурации: " + err.Error())
+	}
+	return data
+}
+
+// Выполнение команды с записью в журнал аудита
+func auditCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID string, run func()) {
+	args := strings.Fields(m.Content)
+	if guildID == "" || len(args) == 0 {
+		run()
+		return
+	}
+	if spec := findCommand(args[0]); spec == nil || !spec.Audited {
+		run()
+		return
+	}
+
+	stopTracking := trackCommand(m, nil)
+	before := takeAuditSnapshot(guildID)
+	run()
+	after := takeAuditSnapshot(guildID)
+	result := strings.Join(commandReplies(m), "\n")
+	stopTracking()
+
+	arguments := strings.Join(args[1:], " ")
+	for _, attachment := range m.Attachments {
+		arguments = strings.TrimSpace(arguments + " [файл: " + attachment.Filename + "]")
+	}
+
+	recordAudit(s, guildID, m.Author.ID, m.Author.Username, strings.ToLower(args[0]), arguments, before, after, result)
+}
+
+// Запись в журнал аудита и в канал аудита сервера.
+// Общая для команд, веб-панели и API
+func recordAudit(s *discordgo.Session, guildID, actorID, actorName, command, arguments string, before, after []byte, result string) {
+	entry := auditEntry{
+		GuildID:   guildID,
+		ActorID:   actorID,
+		ActorName: actorName,
+		Command:   command,
+		Arguments: arguments,
+		Result:    truncateAuditResult(result),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	// Конфигурация сохраняется, только если команда её изменила
+	if !bytes.Equal(before, after) {
+		entry.ConfigBefore = string(before)
+		entry.ConfigAfter = string(after)
+	}
+
+	if err := saveAuditEntry(&entry); err != nil {
+		logger.Error("Ошибка записи в журнал аудита: " + err.Error())
+	}
+
+	if serverConfig, exists := GetServerConfig(guildID); exists && serverConfig.AuditChannelID != "" {
+		if _, err := s.ChannelMessageSend(serverConfig.AuditChannelID, formatAuditEntry(&entry, true)); err != nil {
+			logger.Error("Ошибка отправки в канал аудита: " + err.Error())
+		}
+	}
+}
+
+// Результат изменения для журнала аудита: сообщение или текст ошибки
+func auditResult(message string, err error) string {
+	if err != nil {
+		return "Ошибка: " + err.Error()
+	}
+	return message
+}
+
+// Обрезка результата команды до допустимой длины
+func truncateAuditResult(result string) string {
+	if runes := []rune(result); len(runes) > maxAuditResultLength {
+		result = string(runes[:maxAuditResultLength-3]) + "..."
+	}
+	return result
+}
+
+// Сохранение записи журнала аудита
+func saveAuditEntry(entry *auditEntry) error {
+	result, err := db.Exec(`
+		INSERT INTO audit_log (guild_id, actor_id, actor_name, command, arguments, config_before, config_after, result, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.GuildID, entry.ActorID, entry.ActorName, entry.Command, entry.Arguments,
+		entry.ConfigBefore, entry.ConfigAfter, entry.Result, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// Отбор записей журнала аудита
+type auditFilter struct {
+	ActorID string
+	Since   int64
+	Offset  int
+	Limit   int
+}
+
+// Записи журнала аудита сервера, начиная с последних. Возвращает записи и общее количество
+func loadAuditEntries(guildID string, filter auditFilter) ([]auditEntry, int, error) {
+	where := " WHERE guild_id = ?"
+	args := []any{guildID}
+	if filter.ActorID != "" {
+		where += " AND actor_id = ?"
+		args = append(args, filter.ActorID)
+	}
+	if filter.Since > 0 {
+		where += " AND created_at >= ?"
+		args = append(args, filter.Since)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, guild_id, actor_id, actor_name, command, arguments, config_before, config_after, result, created_at
+		FROM audit_log`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// Запись журнала аудита по ID. Возвращает nil, nil, если записи нет
+func loadAuditEntry(guildID string, id int64) (*auditEntry, error) {
+	row := db.QueryRow(`
+		SELECT id, guild_id, actor_id, actor_name, command, arguments, config_before, config_after, result, created_at
+		FROM audit_log WHERE guild_id = ? AND id = ?`, guildID, id)
+
+	entry, err := scanAuditEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// Чтение записи журнала из строки результата запроса
+func scanAuditEntry(row interface{ Scan(...any) error }) (*auditEntry, error) {
+	var entry auditEntry
+	err := row.Scan(&entry.ID, &entry.GuildID, &entry.ActorID, &entry.ActorName, &entry.Command,
+		&entry.Arguments, &entry.ConfigBefore, &entry.ConfigAfter, &entry.Result, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Изменённые разделы конфигурации: поля ServerConfig и имена форм
+func (entry *auditEntry) changedFields() []string {
+	if entry.ConfigBefore == "" {
+		return nil
+	}
+
+	var before, after struct {
+		Server map[string]json.RawMessage `json:"server"`
+		Forms  map[string]json.RawMessage `json:"forms"`
+	}
+	if json.Unmarshal([]byte(entry.ConfigBefore), &before) != nil || json.Unmarshal([]byte(entry.ConfigAfter), &after) != nil {
+		return nil
+	}
+
+	changed := []string{}
+	diff := func(prefix string, left, right map[string]json.RawMessage) {
+		keys := make(map[string]bool)
+		for key := range left {
+			keys[key] = true
+		}
+		for key := range right {
+			keys[key] = true
+		}
+		for key := range keys {
+			if !bytes.Equal(left[key], right[key]) {
+				changed = append(changed, prefix+key)
+			}
+		}
+	}
+	diff("", before.Server, after.Server)
+	diff("форма ", before.Forms, after.Forms)
+
+	sort.Strings(changed)
+	return changed
+}
+
+// Автор записи: упоминание пользователя или название веб-панели и API
+func (entry *auditEntry) actor() string {
+	if entry.ActorID == auditActorWeb || entry.ActorID == auditActorAPI {
+		return entry.ActorName
+	}
+	return "<@" + entry.ActorID + ">"
+}
+
+// Форматирование записи журнала для Discord
+func formatAuditEntry(entry *auditEntry, detailed bool) string {
+	command := strings.TrimSpace(entry.Command + " " + entry.Arguments)
+	response := fmt.Sprintf("`#%d` %s %s ` %s `", entry.ID, formatTimestamp(entry.CreatedAt), entry.actor(), command)
+	if !detailed {
+		if result, _, _ := strings.Cut(entry.Result, "\n"); result != "" {
+			response += " - " + result
+		}
+		return response
+	}
+
+	if changed := entry.changedFields(); len(changed) > 0 {
+		response += "\nИзменено: " + strings.Join(changed, ", ")
+	}
+	if entry.Result != "" {
+		response += "\nРезультат:\n" + entry.Result
+	}
+	if runes := []rune(response); len(runes) > 2000 {
+		response = string(runes[:1997]) + "..."
+	}
+	return response
+}
+
+// Обработка команды !audit [--user @user] [--since YYYY-MM-DD] [--page N] [--id N]
+func (sc *ServerConfig) handleAuditCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	filter := auditFilter{Limit: auditPageSize, ActorID: call.Flag("user")}
+	page := 1
+	if number, err := strconv.Atoi(call.Flag("page")); err == nil && number > 0 {
+		page = number
+	}
+	entryID, _ := strconv.ParseInt(call.Flag("id"), 10, 64)
+
+	if call.HasFlag("since") {
+		date, err := time.ParseInLocation("2006-01-02", call.Flag("since"), time.Local)
+		if err != nil {
+			reply(s, m, "Дата должна быть в формате YYYY-MM-DD")
+			return
+		}
+		filter.Since = date.Unix()
+	}
+
+	if entryID > 0 {
+		entry, err := loadAuditEntry(sc.GuildID, entryID)
+		if err != nil {
+			logger.Error("Ошибка загрузки журнала аудита: " + err.Error())
+			reply(s, m, "Ошибка загрузки журнала аудита: "+err.Error())
+			return
+		}
+		if entry == nil {
+			reply(s, m, fmt.Sprintf("Запись `#%d` не найдена", entryID))
+			return
+		}
+		reply(s, m, formatAuditEntry(entry, true))
+		return
+	}
+
+	filter.Offset = (page - 1) * auditPageSize
+	entries, total, err := loadAuditEntries(sc.GuildID, filter)
+	if err != nil {
+		logger.Error("Ошибка загрузки журнала аудита: " + err.Error())
+		reply(s, m, "Ошибка загрузки журнала аудита: "+err.Error())
+		return
+	}
+	if total == 0 {
+		reply(s, m, "Журнал аудита пуст")
+		return
+	}
+
+	pages := (total + auditPageSize - 1) / auditPageSize
+	response := fmt.Sprintf("**Журнал аудита** (записей: %d, страница %d из %d)\n", total, page, pages)
+	for i := range entries {
+		line := formatAuditEntry(&entries[i], false)
+		if runes := []rune(line); len(runes) > 180 {
+			line = string(runes[:177]) + "..."
+		}
+		response += line + "\n"
+	}
+	if page < pages {
+		response += fmt.Sprintf("\nСледующая страница: `--page %d`. Подробности записи: `!audit --id N`", page+1)
+	}
+
+	reply(s, m, response)
+}
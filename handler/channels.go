@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// Ограничение Discord на количество каналов в одной категории
+	maxChannelsPerCategory = 50
+	// Ограничение Discord на длину названия канала
+	maxChannelNameLength = 100
+
+	defaultChannelNameTemplate = "регистрация-{username}"
+)
+
+// Категории для каналов регистрации в порядке заполнения
+func (sc *ServerConfig) registrationCategories() []string {
+	categories := []string{}
+	if sc.CategoryID != "" {
+		categories = append(categories, sc.CategoryID)
+	}
+	for _, categoryID := range sc.OverflowCategoryIDs {
+		if categoryID != "" && categoryID != sc.CategoryID {
+			categories = append(categories, categoryID)
+		}
+	}
+	return categories
+}
+
+// Выбор первой категории, в которой ещё есть место для канала
+func (sc *ServerConfig) pickRegistrationCategory(channels []*discordgo.Channel) (string, error) {
+	categories := sc.registrationCategories()
+	if len(categories) == 0 {
+		return "", nil
+	}
+
+	counts := make(map[string]int)
+	for _, channel := range channels {
+		counts[channel.ParentID]++
+	}
+
+	for _, categoryID := range categories {
+		if counts[categoryID] < maxChannelsPerCategory {
+			return categoryID, nil
+		}
+	}
+	return "", fmt.Errorf("все категории регистрации заполнены (%d шт.)", len(categories))
+}
+
+// Название канала регистрации по шаблону сервера
+func (sc *ServerConfig) registrationChannelName(user *discordgo.User) string {
+	template := sc.ChannelNameTemplate
+	if template == "" {
+		template = defaultChannelNameTemplate
+	}
+
+	shortID := user.ID
+	if len(shortID) > 4 {
+		shortID = shortID[len(shortID)-4:]
+	}
+
+	name := strings.NewReplacer(
+		"{username}", user.Username,
+		"{display_name}", user.DisplayName(),
+		"{short_id}", shortID,
+		"{user_id}", user.ID,
+	).Replace(template)
+
+	name = sanitizeChannelName(name)
+	if name == "" {
+		name = "регистрация-" + user.ID
+	}
+	return name
+}
+
+// Приведение строки к допустимому названию текстового канала:
+// строчные буквы, цифры, дефисы и подчёркивания
+func sanitizeChannelName(name string) string {
+	var builder strings.Builder
+	lastDash := true // не начинаем название с дефиса
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			builder.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			// Пробелы, дефисы и прочие символы заменяются одним дефисом
+			builder.WriteRune('-')
+			lastDash = true
+		}
+	}
+
+	result := strings.TrimRight(builder.String(), "-")
+	if runes := []rune(result); len(runes) > maxChannelNameLength {
+		result = strings.TrimRight(string(runes[:maxChannelNameLength]), "-")
+	}
+	return result
+}
+
+// Добавление числового суффикса, если канал с таким названием уже существует
+func uniqueChannelName(name string, channels []*discordgo.Channel) string {
+	existing := make(map[string]bool)
+	for _, channel := range channels {
+		existing[channel.Name] = true
+	}
+
+	if !existing[name] {
+		return name
+	}
+
+	for i := 2; ; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if runes := []rune(base); len(runes)+len(suffix) > maxChannelNameLength {
+			base = string(runes[:maxChannelNameLength-len(suffix)])
+		}
+		if candidate := base + suffix; !existing[candidate] {
+			return candidate
+		}
+	}
+}
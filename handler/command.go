@@ -6,45 +6,189 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-// Обработка команд администратора
-func (sc *ServerConfig) handleAdminCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	// Проверка прав администратора
-	if !IsAdmin(s, m) {
-		logger.Warn("Попытка пользователя использовать команды")
-		s.ChannelMessageSend(m.ChannelID, "У вас недостаточно прав для выполнения этой команды")
-		return
-	}
-	
-	// Разбираем команду и аргументы
-	args := strings.Fields(m.Content)
-	if len(args) == 0 {
-		return
-	}
-	
-	command := strings.ToLower(args[0])
-	
-	switch command {
-	case "!clsroles":
-		logger.Info("Запуск команды !сlsRoles")
-		sc.removeAllRoles(s, m)
-
-	case "!startregistred":
-		logger.Info("Запуск команды !startRegistred")
-		sc.handleStartRegistrationCommand(s, m, args[1:])
+func init() {
+	commandRegistry = append([]*commandSpec{initCommand()}, adminCommands()...)
+}
 
-	case "!stopregistred":
-		logger.Info("Запуск команды !stopRegistred")
-		sc.handleStopRegistrationCommand(s, m, args[1:])
+// Команды администратора
+func adminCommands() []*commandSpec {
+	userFlag := commandFlag{Name: "user_id", Value: "USER_ID", Description: "Применяется к конкретному пользователю", Kind: argUser}
+	allFlag := commandFlag{Name: "all", Description: "Применяется ко всем пользователям (по умолчанию)"}
+	sinceFlag := commandFlag{Name: "since", Value: "YYYY-MM-DD", Description: "Начиная с даты"}
+	pageFlag := commandFlag{Name: "page", Value: "N", Description: "Номер страницы", Kind: argInteger}
+	userArg := commandArg{Name: "user", Description: "Упоминание или ID пользователя", Kind: argUser, Required: true}
+	targetArg := commandArg{Name: "target", Description: "Команда или группа: " + strings.Join(commandGroups, ", "), Required: true}
+	roleArg := commandArg{Name: "role", Description: "Роль", Kind: argRole, Required: true}
 
-	case "!help":
-		logger.Info("Запуск команды !help")
-		sc.showHelp(s, m)
+	return []*commandSpec{
+		{
+			Name:        "status",
+			Description: "Статус бота и сервера",
+			Group:       "stats",
+			Slash:       "status",
+			Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+				sc.handleStatusCommand(s, m)
+			},
+		},
+		{
+			Name:        "startRegistred",
+			Audited:     true,
+			Description: "Запускает регистрацию для пользователей без роли регистрации",
+			Flags: []commandFlag{allFlag, userFlag,
+				{Name: "form", Value: "NAME", Description: "Форма регистрации (по умолчанию default)", Kind: argForm}},
+			Group: "registration",
+			Slash: "registration start",
+			Run:   (*ServerConfig).handleStartRegistrationCommand,
+		},
+		{
+			Name:        "stopRegistred",
+			Audited:     true,
+			Description: "Прерывает активные регистрационные сессии",
+			Details:     "Прерванные регистрации потребуют повторного запуска",
+			Flags:       []commandFlag{allFlag, userFlag},
+			Group:       "registration",
+			Slash:       "registration stop",
+			Run:         (*ServerConfig).handleStopRegistrationCommand,
+		},
+		{
+			Name:        "clsRoles",
+			Audited:     true,
+			Description: "Снимает роли у всех участников сервера, кроме сохраняемых",
+			Details: "Не снимаются @everyone, роли из `!init preserved`, роли интеграций и ботов и роли не ниже роли бота. " +
+				"Без флагов команда показывает отчёт и код подтверждения. Перед очисткой роли участников сохраняются в снимок для `!restoreRoles`",
+			Flags: []commandFlag{
+				{Name: "dry-run", Description: "Только отчёт, без кода подтверждения"},
+				{Name: "confirm", Value: "CODE", Description: "Код подтверждения из отчёта"},
+			},
+			Group: "roles",
+			Slash: "roles clear",
+			Run:   (*ServerConfig).handleClearRolesCommand,
+		},
+		{
+			Name:        "restoreRoles",
+			Audited:     true,
+			Description: "Возвращает роли из снимка, сохранённого перед !clsRoles",
+			Details:     "Без номера показывает последние снимки",
+			Args:        []commandArg{{Name: "snapshot", Description: "Номер снимка", Kind: argInteger}},
+			Group:       "roles",
+			Slash:       "roles restore",
+			Run:         (*ServerConfig).handleRestoreRolesCommand,
+		},
+		{
+			Name:        "profile",
+			Description: "Показывает сохранённый профиль участника",
+			Args:        []commandArg{userArg},
+			Group:       "stats",
+			Run:         (*ServerConfig).handleProfileCommand,
+		},
+		{
+			Name:        "whois",
+			Description: "Показывает ответы регистрации, профиль, дату завершения и проверяющего",
+			Args:        []commandArg{userArg},
+			Group:       "stats",
+			Run:         (*ServerConfig).handleWhoisCommand,
+		},
+		{
+			Name:        "search",
+			Description: "Ищет участников по полям профиля и ответам регистрации",
+			Args:        []commandArg{{Name: "field=value", Description: "Поле профиля или ID вопроса и искомое значение", Required: true, Rest: true}},
+			Flags:       []commandFlag{pageFlag},
+			Group:       "stats",
+			Run:         (*ServerConfig).handleSearchCommand,
+		},
+		{
+			Name:        "export",
+			Description: "Выгружает регистрации или профили участников файлом",
+			Args:        []commandArg{{Name: "kind", Description: "Что выгрузить", Required: true, Choices: []string{"registrations", "profiles"}}},
+			Flags: []commandFlag{sinceFlag,
+				{Name: "format", Value: "csv|json", Description: "Формат файла (по умолчанию csv)", Choices: []string{ExportFormatCSV, ExportFormatJSON}}},
+			Group: "stats",
+			Run:   (*ServerConfig).handleExportCommand,
+		},
+		{
+			Name:        "import",
+			Audited:     true,
+			Description: "Импорт списка участников из CSV-файла",
+			Group:       "registration",
+			Subcommands: []*commandSpec{
+				{Name: "roster", Description: "Пробный импорт: отчёт без изменений", Attachment: "CSV-файл (discord_id или username, family_name, role)",
+					Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+						sc.prepareRosterImport(s, m)
+					}},
+				{Name: "apply", Description: "Применяет подготовленный импорт",
+					Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+						sc.applyRosterImport(s, m)
+					}},
+				{Name: "cancel", Description: "Отменяет подготовленный импорт",
+					Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+						sc.cancelRosterImport(s, m)
+					}},
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Статистика регистраций: итоги, отток и время по вопросам, популярные ответы",
+			Args:        []commandArg{{Name: "7d|30d", Description: "Период в днях (по умолчанию 7d)"}},
+			Group:       "stats",
+			Run:         (*ServerConfig).handleStatsCommand,
+		},
+		{
+			Name:        "audit",
+			Description: "Журнал команд администраторов и изменений конфигурации",
+			Flags: []commandFlag{
+				{Name: "user", Value: "@user", Description: "Команды конкретного администратора", Kind: argUser},
+				sinceFlag, pageFlag,
+				{Name: "id", Value: "N", Description: "Подробности записи", Kind: argInteger},
+			},
+			Group: "init",
+			Run:   (*ServerConfig).handleAuditCommand,
+		},
+		{
+			Name:        "perms",
+			Audited:     true,
+			Description: "Права ролей на команды",
+			AdminOnly:   true,
+			Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+				sc.showCommandPermissions(s, m)
+			},
+			Subcommands: []*commandSpec{
+				{Name: "show", Description: "Показывает, каким ролям разрешены команды",
+					Run: func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+						sc.showCommandPermissions(s, m)
+					}},
+				{Name: "allow", Description: "Разрешает роли команду или группу команд", Args: []commandArg{targetArg, roleArg}, Run: (*ServerConfig).handlePermsCommand},
+				{Name: "deny", Description: "Запрещает роли команду или группу команд", Args: []commandArg{targetArg, roleArg}, Run: (*ServerConfig).handlePermsCommand},
+				{Name: "reset", Description: "Оставляет команду или группу только администраторам", Args: []commandArg{targetArg}, Run: (*ServerConfig).handlePermsCommand},
+			},
+		},
+		{
+			Name:        "help",
+			Description: "Справка по командам",
+			Args:        []commandArg{{Name: "command", Description: "Команда и подкоманда, например init panel", Rest: true}},
+			Slash:       "help",
+			Run:         handleHelpCommand,
+		},
+	}
+}
 
-	case "!status":
-		logger.Info("Запуск команды !status")
-		sc.handleStatusCommand(s, m)
+// Обработка команды !help [команда [подкоманда]]
+func handleHelpCommand(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if len(call.Args) == 0 {
+		replyLong(s, m, commandListHelp())
+		return
+	}
 
-	default:
-		s.ChannelMessageSend(m.ChannelID, "Неизвестная команда. Используй `!help` для списка команд")
+	names := strings.Fields(call.Args[0])
+	spec := findCommand(names[0])
+	if spec == nil {
+		reply(s, m, "Неизвестная команда `"+names[0]+"`. Используй `!help` для списка команд")
+		return
+	}
+	if len(names) > 1 && len(spec.Subcommands) > 0 {
+		if sub := spec.findSubcommand(names[1]); sub != nil {
+			replyLong(s, m, sub.help([]string{spec.Name}))
+			return
+		}
 	}
+	replyLong(s, m, spec.help(nil))
 }
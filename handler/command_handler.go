@@ -1,81 +1,37 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"net/http"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// Удаление всех ролей у всех пользователей
-func (sc *ServerConfig) removeAllRoles(s *discordgo.Session, m *discordgo.MessageCreate) {
-	s.ChannelMessageSend(m.ChannelID, "Начинаю удаление всех ролей... Это может занять время")
-
-	members, err := s.GuildMembers(sc.GuildID, "", 1000)
+// Запуск регистрации для незарегистрированных
+func (sc *ServerConfig) startRegistrationForUnregistered(s *discordgo.Session, m *discordgo.MessageCreate, formName string) {
+	count, err := sc.registerUnregisteredMembers(s, formName, m.Author.ID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, "Ошибка получения списка участников: "+err.Error())
+		reply(s, m, err.Error())
 		return
 	}
 
-	everyoneRoleID := ""
-	roles, err := s.GuildRoles(sc.GuildID)
-	if err == nil {
-		for _, role := range roles {
-			if role.Name == "@everyone" {
-				everyoneRoleID = role.ID
-				break
-			}
-		}
-	}
-
-	successCount := 0
-	failCount := 0
-
-	for _, member := range members {
-		// Пропускаем ботов
-		if member.User.Bot {
-			continue
-		}
-
-		// Оставляем только роль @everyone
-		newRoles := []string{}
-		if everyoneRoleID != "" {
-			newRoles = append(newRoles, everyoneRoleID)
-		}
-
-		_, err := s.GuildMemberEdit(sc.GuildID, member.User.ID, &discordgo.GuildMemberParams{
-			Roles: &newRoles,
-		})
-
-		if err != nil {
-			fmt.Printf("Ошибка удаления ролей у %s: %v\n", member.User.Username, err)
-			failCount++
-		} else {
-			successCount++
-		}
-
-		// Задержка для предотвращения лимитов
-		time.Sleep(200 * time.Millisecond)
-	}
-
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf(
-		"Удаление ролей завершено!\nУспешно: %d\nНе удалось: %d",
-		successCount, failCount))
+	reply(s, m, fmt.Sprintf(
+		"Запущена регистрация для %d пользователей, в очереди: %d", count, queueLength(sc.GuildID)))
 }
 
-// Запуск регистрации для незарегистрированных
-func (sc *ServerConfig) startRegistrationForUnregistered(s *discordgo.Session, m *discordgo.MessageCreate) {
+// Постановка в очередь регистрации всех участников без роли регистрации.
+// Возвращает количество поставленных в очередь
+func (sc *ServerConfig) registerUnregisteredMembers(s *discordgo.Session, formName, reviewerID string) (int, error) {
 	registrationRoleID := findRoleID(s, sc.GuildID, sc.RegistrationRole)
 	if registrationRoleID == "" {
-		s.ChannelMessageSend(m.ChannelID, "Роль 'Регистрация' не найдена")
-		return
+		return 0, fmt.Errorf("Роль 'Регистрация' не найдена")
 	}
 
-	members, err := s.GuildMembers(sc.GuildID, "", 1000)
+	members, err := fetchGuildMembers(s, sc.GuildID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, "Ошибка получения списка участников: "+err.Error())
-		return
+		return 0, fmt.Errorf("Ошибка получения списка участников: %w", err)
 	}
 
 	count := 0
@@ -101,7 +57,7 @@ func (sc *ServerConfig) startRegistrationForUnregistered(s *discordgo.Session, m
 
 		// Проверяем, не в процессе ли уже регистрации
 		mu.Lock()
-		_, inProgress := registeringUsers[member.User.ID]
+		_, inProgress := registeringUsers[sessionKey(sc.GuildID, member.User.ID)]
 		mu.Unlock()
 
 		if !inProgress {
@@ -112,34 +68,40 @@ func (sc *ServerConfig) startRegistrationForUnregistered(s *discordgo.Session, m
 				continue
 			}
 
-			// Запускаем процесс регистрации
-			go func(userID string) {
-				// Даем время для выдачи роли
-				time.Sleep(1 * time.Second)
-				sc.NewGuildMember(s, &discordgo.GuildMemberAdd{
-					Member: &discordgo.Member{
-						GuildID: sc.GuildID,
-						User:    member.User,
-					},
-				})
-			}(member.User.ID)
+			// Ставим в очередь, регистрации запускаются с учётом лимита одновременных сессий
+			sc.enqueueRegistration(s, queuedMember{member: member, form: formName, reviewerID: reviewerID})
 
 			count++
-			time.Sleep(500 * time.Millisecond) // Задержка между запусками
+			time.Sleep(200 * time.Millisecond) // Задержка для предотвращения лимитов
 		}
 	}
 
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf(
-		"Запущена регистрация для %d пользователей", count))
+	return count, nil
 }
 
 // Принудительное прерывание регистраций
 func (sc *ServerConfig) stopAllRegistrations(s *discordgo.Session, m *discordgo.MessageCreate) {
+	count, dequeued := sc.stopGuildRegistrations(s)
+
+	reply(s, m, fmt.Sprintf(
+		"Прервано %d регистрационных сессий, удалено из очереди: %d", count, dequeued))
+}
+
+// Прерывание всех регистраций сервера и очистка очереди.
+// Возвращает количество прерванных сессий и удалённых из очереди
+func (sc *ServerConfig) stopGuildRegistrations(s *discordgo.Session) (int, int) {
+	// Очищаем очередь, чтобы прерванные регистрации не сменились ожидающими
+	dequeued := sc.clearQueue()
+
 	mu.Lock()
 	defer mu.Unlock()
 
 	count := 0
-	for userID, state := range registeringUsers {
+	for key, state := range registeringUsers {
+		if state.GuildID != sc.GuildID {
+			continue
+		}
+
 		// Удаляем канал
 		_, err := s.ChannelDelete(state.ChannelID)
 		if err != nil {
@@ -148,102 +110,59 @@ func (sc *ServerConfig) stopAllRegistrations(s *discordgo.Session, m *discordgo.
 			count++
 		}
 
+		if err := recordRegistration(state, OutcomeRejected); err != nil {
+			logger.Error("Ошибка записи истории регистрации: " + err.Error())
+		}
+
 		// Удаляем из списка регистрирующихся
-		delete(registeringUsers, userID)
+		delete(registeringUsers, key)
 	}
 
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf(
-		"Прервано %d регистрационных сессий", count))
-}
-
-// Отображение справки по командам
-func (sc *ServerConfig) showHelp(s *discordgo.Session, m *discordgo.MessageCreate) {
-	helpMessage := `**Доступные команды администратора:**
-
-!clsRoles - Удаляет ВСЕ роли у ВСЕХ пользователей сервера
-!startRegistred [--all] [--user_id USER_ID] - Запускает регистрацию для пользователей без роли "Регистрация"
-!stopRegistred [--all] [--user_id USER_ID] - Принудительно прерывает активные регистрационные сессии
-!help - Показывает это сообщение
-
-Флаги:
---all           - Применяется ко всем пользователям (по умолчанию)
---user_id ID    - Применяется к конкретному пользователю по ID
-
-**Внимание:**
-- Команды работают только в специальном канале для команд
-- Требуют прав администратора
-- Команда !clsRoles необратима и удаляет ВСЕ роли у ВСЕХ пользователей
-- Прерванные регистрации (!stopRegistred) потребуют повторного запуска`
-
-	s.ChannelMessageSend(m.ChannelID, helpMessage)
+	return count, dequeued
 }
 
+// Обработка команды !status
 func (sc *ServerConfig) handleStatusCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
-	mu.Lock()
-	activeSessions := len(registeringUsers)
-	mu.Unlock()
+	activeSessions := countGuildSessions(sc.GuildID)
 
 	// Получаем статистику сервера
 	guild, _ := s.Guild(sc.GuildID)
 
-	response := fmt.Sprintf("**Статус бота:**\nВерсия: 1.0.0\nПинг: %dms\nАктивных сессий: %d\n\n**Статистика сервера:**\nГильдия: %s\nВсего участников: %d\nРолей: %d\n\n**Автор**: <@302859679929729024>",
+	response := fmt.Sprintf("**Статус бота:**\nВерсия: 1.0.0\nПинг: %dms\nАктивных сессий: %d\nВ очереди: %d\n\n**Статистика сервера:**\nГильдия: %s\nВсего участников: %d\nРолей: %d\n\n**Автор**: <@302859679929729024>",
 		s.HeartbeatLatency().Milliseconds(),
 		activeSessions,
+		queueLength(sc.GuildID),
 		guild.Name,
 		len(guild.Members),
 		len(guild.Roles))
 
-	s.ChannelMessageSend(m.ChannelID, response)
+	reply(s, m, response)
 }
 
-// Обработка команды startRegistration с флагами
-func (sc *ServerConfig) handleStartRegistrationCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	userID := ""
+// Обработка команды !startRegistred
+func (sc *ServerConfig) handleStartRegistrationCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	formName := DefaultFormName
+	if call.HasFlag("form") {
+		formName = call.Flag("form")
+	}
 
-	// Парсим аргументы
-	for i := 0; i < len(args); i++ {
-		arg := strings.ToLower(args[i])
-		switch arg {
-		case "--all":
-			// Флаг --all является поведением по умолчанию, когда не указан --user_id
-			continue
-		case "--user_id":
-			if i+1 < len(args) {
-				userID = args[i+1]
-				i++ // Пропускаем следующий аргумент (значение user_id)
-			}
-		}
+	if _, exists := GetRegistrationForm(sc.GuildID, formName); !exists {
+		reply(s, m, "Форма регистрации `"+formName+"` не найдена. Список форм: `!init forms`")
+		return
 	}
 
-	if userID != "" {
+	if userID := call.Flag("user_id"); userID != "" {
 		// Запуск регистрации для конкретного пользователя
-		sc.startRegistrationForUser(s, m, userID)
+		sc.startRegistrationForUser(s, m, userID, formName)
 	} else {
 		// Запуск регистрации для всех незарегистрированных (поведение по умолчанию)
-		sc.startRegistrationForUnregistered(s, m)
+		sc.startRegistrationForUnregistered(s, m, formName)
 	}
 }
 
-// Обработка команды stopRegistration с флагами
-func (sc *ServerConfig) handleStopRegistrationCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	userID := ""
-
-	// Парсим аргументы
-	for i := 0; i < len(args); i++ {
-		arg := strings.ToLower(args[i])
-		switch arg {
-		case "--all":
-			// Флаг --all является поведением по умолчанию, когда не указан --user_id
-			continue
-		case "--user_id":
-			if i+1 < len(args) {
-				userID = args[i+1]
-				i++ // Пропускаем следующий аргумент (значение user_id)
-			}
-		}
-	}
-
-	if userID != "" {
+// Обработка команды !stopRegistred
+func (sc *ServerConfig) handleStopRegistrationCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if userID := call.Flag("user_id"); userID != "" {
 		// Остановка регистрации для конкретного пользователя
 		sc.stopRegistrationForUser(s, m, userID)
 	} else {
@@ -253,81 +172,126 @@ func (sc *ServerConfig) handleStopRegistrationCommand(s *discordgo.Session, m *d
 }
 
 // Запуск регистрации для конкретного пользователя
-func (sc *ServerConfig) startRegistrationForUser(s *discordgo.Session, m *discordgo.MessageCreate, userID string) {
+func (sc *ServerConfig) startRegistrationForUser(s *discordgo.Session, m *discordgo.MessageCreate, userID, formName string) {
+	if err := sc.registerMember(s, userID, formName, m.Author.ID); err != nil {
+		reply(s, m, err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Запущена регистрация для пользователя <@%s>", userID))
+}
+
+// Причины отказа в запуске регистрации участника
+const (
+	registerFailed   = iota // прочая ошибка, например в конфигурации сервера
+	registerNotFound        // участника нет на сервере
+	registerConflict        // участник уже регистрируется или не может её пройти
+	registerDiscord         // ошибка запроса к Discord
+)
+
+// Ошибка запуска регистрации участника с причиной отказа
+type registerError struct {
+	reason int
+	err    error
+}
+
+func (e *registerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *registerError) Unwrap() error {
+	return e.err
+}
+
+// Создание ошибки запуска регистрации
+func registerErrorf(reason int, format string, args ...any) error {
+	return &registerError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+// Причина отказа в запуске регистрации
+func registerErrorReason(err error) int {
+	var registerErr *registerError
+	if errors.As(err, &registerErr) {
+		return registerErr.reason
+	}
+	return registerFailed
+}
+
+// Постановка участника в очередь регистрации по форме
+func (sc *ServerConfig) registerMember(s *discordgo.Session, userID, formName, reviewerID string) error {
 	registrationRoleID := findRoleID(s, sc.GuildID, sc.RegistrationRole)
 	if registrationRoleID == "" {
-		s.ChannelMessageSend(m.ChannelID, "Роль 'Регистрация' не найдена")
-		return
+		return fmt.Errorf("Роль 'Регистрация' не найдена")
 	}
 
 	// Получаем информацию о пользователе
 	member, err := s.GuildMember(sc.GuildID, userID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, "Пользователь не найден: "+err.Error())
-		return
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+			return registerErrorf(registerNotFound, "Пользователь не найден: %w", err)
+		}
+		return registerErrorf(registerDiscord, "Ошибка получения пользователя <@%s>: %w", userID, err)
 	}
 
 	// Пропускаем ботов
 	if member.User.Bot {
-		s.ChannelMessageSend(m.ChannelID, "Боты не могут проходить регистрацию")
-		return
+		return registerErrorf(registerConflict, "Боты не могут проходить регистрацию")
 	}
 
 	// Проверяем наличие роли регистрации
-	hasRegistrationRole := false
 	for _, role := range member.Roles {
+		// Если пользователь уже имеет роль регистрации, пропускаем
 		if role == registrationRoleID {
-			hasRegistrationRole = true
-			break
+			return registerErrorf(registerConflict, "Пользователь <@%s> уже имеет роль регистрации", userID)
 		}
 	}
 
-	// Если пользователь уже имеет роль регистрации, пропускаем
-	if hasRegistrationRole {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Пользователь <@%s> уже имеет роль регистрации", userID))
-		return
-	}
-
 	// Проверяем, не в процессе ли уже регистрации
 	mu.Lock()
-	_, inProgress := registeringUsers[userID]
+	_, inProgress := registeringUsers[sessionKey(sc.GuildID, userID)]
 	mu.Unlock()
 
 	if inProgress {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Пользователь <@%s> уже находится в процессе регистрации", userID))
-		return
+		return registerErrorf(registerConflict, "Пользователь <@%s> уже находится в процессе регистрации", userID)
 	}
 
 	// Добавляем роль регистрации
 	err = s.GuildMemberRoleAdd(sc.GuildID, userID, registrationRoleID)
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Ошибка выдачи роли пользователю <@%s>: %v", userID, err))
-		return
+		return registerErrorf(registerDiscord, "Ошибка выдачи роли пользователю <@%s>: %w", userID, err)
 	}
 
 	// Запускаем процесс регистрации
-	go func() {
-		// Даем время для выдачи роли
-		time.Sleep(1 * time.Second)
-		sc.NewGuildMember(s, &discordgo.GuildMemberAdd{
-			Member: &discordgo.Member{
-				GuildID: sc.GuildID,
-				User:    member.User,
-			},
-		})
-	}()
-
-	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Запущена регистрация для пользователя <@%s>", userID))
+	if _, added := sc.enqueueRegistration(s, queuedMember{member: member, form: formName, reviewerID: reviewerID}); !added {
+		return registerErrorf(registerConflict, "Пользователь <@%s> уже находится в очереди или в процессе регистрации", userID)
+	}
+	return nil
 }
 
 // Остановка регистрации для конкретного пользователя
 func (sc *ServerConfig) stopRegistrationForUser(s *discordgo.Session, m *discordgo.MessageCreate, userID string) {
+	result, err := sc.stopMemberRegistration(s, userID)
+	if err != nil {
+		reply(s, m, err.Error())
+		return
+	}
+
+	reply(s, m, result)
+}
+
+// Прерывание регистрации участника или удаление его из очереди.
+// Возвращает описание результата для администратора
+func (sc *ServerConfig) stopMemberRegistration(s *discordgo.Session, userID string) (string, error) {
+	if sc.removeFromQueue(userID) {
+		return fmt.Sprintf("Пользователь <@%s> удалён из очереди регистрации", userID), nil
+	}
+
 	mu.Lock()
-	state, exists := registeringUsers[userID]
+	state, exists := registeringUsers[sessionKey(sc.GuildID, userID)]
 	if !exists {
 		mu.Unlock()
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Пользователь <@%s> не находится в процессе регистрации", userID))
-		return
+		return "", fmt.Errorf("Пользователь <@%s> не находится в процессе регистрации", userID)
 	}
 
 	// Удаляем канал
@@ -335,13 +299,18 @@ func (sc *ServerConfig) stopRegistrationForUser(s *discordgo.Session, m *discord
 	mu.Unlock()
 
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Ошибка удаления канала пользователя <@%s>: %v", userID, err))
-	} else {
-		// Удаляем из списка регистрирующихся
-		mu.Lock()
-		delete(registeringUsers, userID)
-		mu.Unlock()
-		
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Регистрация пользователя <@%s> прервана", userID))
+		return "", fmt.Errorf("Ошибка удаления канала пользователя <@%s>: %w", userID, err)
 	}
+
+	// Удаляем из списка регистрирующихся
+	mu.Lock()
+	delete(registeringUsers, sessionKey(sc.GuildID, userID))
+	mu.Unlock()
+
+	if err := recordRegistration(state, OutcomeRejected); err != nil {
+		logger.Error("Ошибка записи истории регистрации: " + err.Error())
+	}
+
+	sc.dispatchQueue(s)
+	return fmt.Sprintf("Регистрация пользователя <@%s> прервана", userID), nil
 }
@@ -16,26 +16,66 @@ type ServerConfig struct {
 	CommandChannelID string `json:"command_channel_id"`
 	GuildRoleId      string `json:"guild_role_id"`
 	FriendRoleId     string `json:"friend_role_id"`
+	ReturningPolicy  string `json:"returning_policy"` // reregister, confirm, auto
+
+	// Очередь регистрации и защита от наплыва участников
+	MaxConcurrentRegistrations int `json:"max_concurrent_registrations"` // 0 - значение по умолчанию
+	RaidJoinLimit              int `json:"raid_join_limit"`              // 0 - обнаружение наплыва выключено
+	RaidWindowSeconds          int `json:"raid_window_seconds"`
+	RaidPauseMinutes           int `json:"raid_pause_minutes"`
+
+	// Каналы регистрации
+	OverflowCategoryIDs []string `json:"overflow_category_ids"` // заполняются по порядку после CategoryID
+	ChannelNameTemplate string   `json:"channel_name_template"` // {username}, {display_name}, {short_id}, {user_id}
+
+	// Права в каналах регистрации
+	StaffRoles           []StaffRole `json:"staff_roles"`
+	ApplicantPermissions []string    `json:"applicant_permissions"`
+
+	// Судьба канала после завершения регистрации
+	ChannelPolicy        string `json:"channel_policy"`       // delete, archive, keep
+	ChannelDeleteDelay   int    `json:"channel_delete_delay"` // секунды до удаления или архивации
+	ArchiveCategoryID    string `json:"archive_category_id"`
+	ArchiveRetentionDays int    `json:"archive_retention_days"` // 0 - хранить архив бессрочно
+
+	// Панель регистрации
+	RegistrationMode string `json:"registration_mode"` // auto, panel
+	PanelChannelID   string `json:"panel_channel_id"`
+	PanelMessageID   string `json:"panel_message_id"`
+
+	// Роли, которым разрешены команды или группы команд (init, registration, roles, stats)
+	CommandPermissions map[string][]string `json:"command_permissions,omitempty"`
+
+	// Канал, в который дублируется журнал аудита
+	AuditChannelID string `json:"audit_channel_id,omitempty"`
+
+	// Роли, которые не снимаются командой !clsRoles
+	PreservedRoles []string `json:"preserved_roles,omitempty"`
 }
 
 // RegistrationConfig - основная структура конфигурации
 type RegistrationConfig struct {
-	Version    string     `json:"version"`
-	Questions  []Question `json:"questions"`
-	Completion Completion `json:"completion"`
+	Name       string      `json:"name,omitempty"`    // имя формы, основная форма - default
+	Title      string      `json:"title,omitempty"`   // название формы на панели регистрации
+	Trigger    string      `json:"trigger,omitempty"` // join, panel, admin, self
+	Version    string      `json:"version"`
+	Questions  []Question  `json:"questions"`
+	Completion Completion  `json:"completion"`
+	Appearance *Appearance `json:"appearance,omitempty"` // оформление вопросов формы
 }
 
 // Question - вопрос регистрации
 type Question struct {
-	ID         string     `json:"id"`
-	Order      int        `json:"order"`
-	Type       string     `json:"type"` // single_choice, multiple_choice, text_input, number_input
-	Required   bool       `json:"required"`
-	Text       string     `json:"text"`
-	Options    []Option   `json:"options,omitempty"`
+	ID         string      `json:"id"`
+	Order      int         `json:"order"`
+	Type       string      `json:"type"` // single_choice, multiple_choice, text_input, number_input
+	Required   bool        `json:"required"`
+	Text       string      `json:"text"`
+	Options    []Option    `json:"options,omitempty"`
 	Validation *Validation `json:"validation,omitempty"`
-	Actions    []Action   `json:"actions,omitempty"`
-	Next       NextStep   `json:"next"`
+	Actions    []Action    `json:"actions,omitempty"`
+	Next       NextStep    `json:"next"`
+	Appearance *Appearance `json:"appearance,omitempty"` // переопределение оформления формы
 }
 
 // Option - вариант ответа
@@ -75,8 +115,8 @@ type NextStep struct {
 
 // Condition - условие перехода
 type Condition struct {
-	If        ConditionCheck `json:"if"`
-	QuestionID string        `json:"question_id"`
+	If         ConditionCheck `json:"if"`
+	QuestionID string         `json:"question_id"`
 }
 
 // ConditionCheck - проверка условия
@@ -88,25 +128,31 @@ type ConditionCheck struct {
 
 // Completion - действия при завершении
 type Completion struct {
-	Message string   `json:"message"`
-	Actions []Action `json:"actions,omitempty"`
+	Message       string         `json:"message"`
+	Actions       []Action       `json:"actions,omitempty"`
+	Announcements []Announcement `json:"announcements,omitempty"` // объявления о новом участнике
 }
 
 // Ответ пользователя
 type UserAnswer struct {
 	QuestionID string      `json:"question_id"`
-	Value      interface{} `json:"value"` // string, []string, int, etc.
+	Value      interface{} `json:"value"`              // string, []string, int, etc.
 	Selected   *Option     `json:"selected,omitempty"` // Для choice типов
+	AnsweredAt int64       `json:"answered_at,omitempty"`
 }
 
 // Сессия пользователя
 type UserSession struct {
-	UserID      string                 `json:"user_id"`
-	ChannelID   string                 `json:"channel_id"`
-	CurrentQID  string                 `json:"current_question_id"`
-	Answers     map[string]UserAnswer  `json:"answers"`
-	Data        map[string]interface{} `json:"data"` // session storage
-	StartedAt   int64                  `json:"started_at"`
+	GuildID    string                 `json:"guild_id"`
+	UserID     string                 `json:"user_id"`
+	ChannelID  string                 `json:"channel_id"`
+	FormName   string                 `json:"form"`
+	ReviewerID string                 `json:"reviewer_id,omitempty"` // администратор, запустивший регистрацию
+	CurrentQID string                 `json:"current_question_id"`
+	Answers    map[string]UserAnswer  `json:"answers"`
+	Data       map[string]interface{} `json:"data"`              // session storage
+	Profile    map[string]string      `json:"profile,omitempty"` // постоянный профиль участника
+	StartedAt  int64                  `json:"started_at"`
 }
 
 // BotHandler - основной обработчик бота
@@ -121,14 +167,32 @@ func NewBotHandler(session *discordgo.Session) *BotHandler {
 
 // Глобальные переменные
 var (
-	DBPath           = "./registration.db"
-	db               *sql.DB
-	registrationConfigs = make(map[string]*RegistrationConfig) // guild_id -> config
-	serverConfigs    = make(map[string]*ServerConfig)           // guild_id -> config
-	registeringUsers = make(map[string]*UserSession)
-	mu               sync.Mutex
+	DBPath              = "./registration.db"
+	db                  *sql.DB
+	registrationConfigs = make(map[string]*RegistrationConfig)            // guild_id -> config
+	registrationForms   = make(map[string]map[string]*RegistrationConfig) // guild_id -> имя формы -> config
+	serverConfigs       = make(map[string]*ServerConfig)                  // guild_id -> config
+	registeringUsers    = make(map[string]*UserSession)                   // guild_id/user_id -> сессия
+	pendingTimers       = make(map[int64]*pendingTask)                    // task_id -> отложенная задача
+	mu                  sync.Mutex
+	timersMu            sync.Mutex
+)
+
+// Итоги регистрационной сессии
+const (
+	OutcomeCompleted = "completed"
+	OutcomeAbandoned = "abandoned"
+	OutcomeRestored  = "restored"
+	OutcomeImported  = "imported"
+	OutcomeRejected  = "rejected"
 )
 
+// Ключ регистрационной сессии: участник может одновременно
+// проходить регистрацию на нескольких серверах
+func sessionKey(guildID, userID string) string {
+	return guildID + "/" + userID
+}
+
 // ForEachServerConfig - функция для перебора всех зарегистрированных серверов
 func ForEachServerConfig(fn func(guildID string, config *ServerConfig)) {
 	mu.Lock()
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Форматы выгрузки
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+// Таблица для выгрузки: фиксированные колонки идут первыми, остальные по алфавиту
+type exportTable struct {
+	fixed []string
+	rows  []map[string]string
+}
+
+// Список колонок таблицы
+func (t *exportTable) columns() []string {
+	known := make(map[string]bool)
+	for _, column := range t.fixed {
+		known[column] = true
+	}
+
+	extra := []string{}
+	for _, row := range t.rows {
+		for column := range row {
+			if !known[column] {
+				known[column] = true
+				extra = append(extra, column)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(append([]string{}, t.fixed...), extra...)
+}
+
+// Кодирование таблицы в CSV или JSON
+func (t *exportTable) encode(format string) ([]byte, error) {
+	columns := t.columns()
+
+	switch format {
+	case ExportFormatJSON:
+		rows := make([]map[string]string, 0, len(t.rows))
+		for _, row := range t.rows {
+			full := make(map[string]string, len(columns))
+			for _, column := range columns {
+				full[column] = row[column]
+			}
+			rows = append(rows, full)
+		}
+		return json.MarshalIndent(rows, "", "  ")
+
+	case ExportFormatCSV:
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		if err := writer.Write(columns); err != nil {
+			return nil, err
+		}
+		for _, row := range t.rows {
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = escapeCSVCell(row[column])
+			}
+			if err := writer.Write(record); err != nil {
+				return nil, err
+			}
+		}
+		writer.Flush()
+		return buffer.Bytes(), writer.Error()
+	}
+
+	return nil, fmt.Errorf("неизвестный формат выгрузки: %s", format)
+}
+
+// Успешный итог сессии: участник прошёл регистрацию
+func successfulOutcome(outcome string) bool {
+	return outcome == OutcomeCompleted || outcome == OutcomeRestored || outcome == OutcomeImported
+}
+
+// Выгрузка регистраций: одна строка на участника с его последней успешной сессией
+// (или последней сессией, если успешных нет) с момента since
+func buildRegistrationsExport(guildID string, since int64) (*exportTable, error) {
+	rows, err := db.Query(`
+		SELECT user_id, outcome, session_json, started_at, finished_at FROM registration_history
+		WHERE guild_id = ? AND finished_at >= ? ORDER BY finished_at, id`,
+		guildID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := &exportTable{fixed: []string{"user_id", "form", "outcome", "reviewer_id", "started_at", "finished_at"}}
+	index := make(map[string]int) // user_id -> номер строки
+	for rows.Next() {
+		var userID, outcome, sessionJSON string
+		var startedAt, finishedAt int64
+		if err := rows.Scan(&userID, &outcome, &sessionJSON, &startedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+
+		var session UserSession
+		if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+			logger.Error("Ошибка парсинга сессии пользователя " + userID + ": " + err.Error())
+			continue
+		}
+
+		row := map[string]string{
+			"user_id":     userID,
+			"form":        normalizeFormName(session.FormName),
+			"outcome":     outcome,
+			"reviewer_id": session.ReviewerID,
+			"started_at":  formatExportTime(startedAt),
+			"finished_at": formatExportTime(finishedAt),
+		}
+		for questionID, answer := range session.Answers {
+			row["answer."+questionID] = formatAnswer(answer)
+		}
+		for field, value := range session.Data {
+			row["data."+field] = fmt.Sprint(value)
+		}
+		for field, value := range session.Profile {
+			row["profile."+field] = value
+		}
+
+		// Более поздняя сессия участника заменяет предыдущую, но незавершённая
+		// или отклонённая не заменяет успешную
+		if i, exists := index[userID]; exists {
+			if successfulOutcome(outcome) || !successfulOutcome(table.rows[i]["outcome"]) {
+				table.rows[i] = row
+			}
+		} else {
+			index[userID] = len(table.rows)
+			table.rows = append(table.rows, row)
+		}
+	}
+
+	return table, rows.Err()
+}
+
+// Выгрузка профилей участников
+func buildProfilesExport(guildID string) (*exportTable, error) {
+	rows, err := db.Query(`
+		SELECT user_id, fields_json, updated_at FROM member_profiles
+		WHERE guild_id = ? ORDER BY updated_at`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := &exportTable{fixed: []string{"user_id", "updated_at"}}
+	for rows.Next() {
+		var userID, fieldsJSON string
+		var updatedAt int64
+		if err := rows.Scan(&userID, &fieldsJSON, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		profile := make(map[string]string)
+		if err := json.Unmarshal([]byte(fieldsJSON), &profile); err != nil {
+			logger.Error("Ошибка парсинга профиля пользователя " + userID + ": " + err.Error())
+			continue
+		}
+
+		row := map[string]string{
+			"user_id":    userID,
+			"updated_at": formatExportTime(updatedAt),
+		}
+		for field, value := range profile {
+			row[field] = value
+		}
+		table.rows = append(table.rows, row)
+	}
+
+	return table, rows.Err()
+}
+
+// Экранирование ячейки CSV: значение, начинающееся с = + - @, табличный
+// редактор принял бы за формулу
+func escapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Время в выгрузке в формате RFC 3339
+func formatExportTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// Обработка команды !export <registrations|profiles> [--since YYYY-MM-DD] [--format csv|json]
+func (sc *ServerConfig) handleExportCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	kind := call.Args[0]
+	format := ExportFormatCSV
+	if call.HasFlag("format") {
+		format = call.Flag("format")
+	}
+
+	var since int64
+	if call.HasFlag("since") {
+		date, err := time.ParseInLocation("2006-01-02", call.Flag("since"), time.Local)
+		if err != nil {
+			reply(s, m, "Дата должна быть в формате YYYY-MM-DD")
+			return
+		}
+		since = date.Unix()
+	}
+
+	var table *exportTable
+	var err error
+	switch kind {
+	case "registrations":
+		table, err = buildRegistrationsExport(sc.GuildID, since)
+	case "profiles":
+		table, err = buildProfilesExport(sc.GuildID)
+	}
+	if err != nil {
+		logger.Error("Ошибка выгрузки: " + err.Error())
+		reply(s, m, "Ошибка выгрузки: "+err.Error())
+		return
+	}
+
+	data, err := table.encode(format)
+	if err != nil {
+		logger.Error("Ошибка выгрузки: " + err.Error())
+		reply(s, m, "Ошибка выгрузки: "+err.Error())
+		return
+	}
+
+	contentType := "text/csv"
+	if format == ExportFormatJSON {
+		contentType = "application/json"
+	}
+
+	err = replyComplex(s, m, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Выгрузка %s: %d записей", kind, len(table.rows)),
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("%s-%s-%s.%s", kind, sc.GuildID, time.Now().Format("20060102"), format),
+			ContentType: contentType,
+			Reader:      bytes.NewReader(data),
+		}},
+	})
+	if err != nil {
+		logger.Error("Ошибка отправки выгрузки: " + err.Error())
+		reply(s, m, "Ошибка отправки выгрузки: "+err.Error())
+	}
+}
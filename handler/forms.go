@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Имя основной формы, которая хранится в registration_configs
+const DefaultFormName = "default"
+
+// Способы запуска формы регистрации
+const (
+	TriggerJoin  = "join"  // при входе на сервер
+	TriggerPanel = "panel" // кнопкой на панели регистрации
+	TriggerAdmin = "admin" // только командой администратора
+	TriggerSelf  = "self"  // командой участника !register
+)
+
+// Проверка корректности способа запуска
+func isValidTrigger(trigger string) bool {
+	switch trigger {
+	case TriggerJoin, TriggerPanel, TriggerAdmin, TriggerSelf:
+		return true
+	}
+	return false
+}
+
+// Приведение имени формы к каноническому виду
+func normalizeFormName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return DefaultFormName
+	}
+	return name
+}
+
+// Имя формы с учётом значения по умолчанию
+func (rc *RegistrationConfig) FormName() string {
+	return normalizeFormName(rc.Name)
+}
+
+// Способ запуска формы с учётом значения по умолчанию:
+// основная форма запускается при входе, остальные - администратором
+func (rc *RegistrationConfig) FormTrigger() string {
+	if rc.Trigger != "" {
+		return rc.Trigger
+	}
+	if rc.FormName() == DefaultFormName {
+		return TriggerJoin
+	}
+	return TriggerAdmin
+}
+
+// Получение формы регистрации гильдии по имени
+func GetRegistrationForm(guildID, name string) (*RegistrationConfig, bool) {
+	name = normalizeFormName(name)
+	if name == DefaultFormName {
+		return GetRegistrationConfig(guildID)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	form, exists := registrationForms[guildID][name]
+	return form, exists
+}
+
+// Список форм регистрации гильдии: основная форма первой, остальные по имени
+func ListRegistrationForms(guildID string) []*RegistrationConfig {
+	mu.Lock()
+	defer mu.Unlock()
+
+	forms := []*RegistrationConfig{}
+	if form, exists := registrationConfigs[guildID]; exists && len(form.Questions) > 0 {
+		forms = append(forms, form)
+	}
+
+	names := make([]string, 0, len(registrationForms[guildID]))
+	for name := range registrationForms[guildID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		forms = append(forms, registrationForms[guildID][name])
+	}
+	return forms
+}
+
+// Формы гильдии с указанным способом запуска
+func formsByTrigger(guildID, trigger string) []*RegistrationConfig {
+	forms := []*RegistrationConfig{}
+	for _, form := range ListRegistrationForms(guildID) {
+		if form.FormTrigger() == trigger {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
+
+// Форма, запускаемая при входе на сервер. Возвращает nil, если такой формы нет
+func joinForm(guildID string) *RegistrationConfig {
+	forms := formsByTrigger(guildID, TriggerJoin)
+	if len(forms) == 0 {
+		return nil
+	}
+	return forms[0]
+}
+
+// Сохранение формы регистрации в БД и в памяти
+func SaveRegistrationForm(guildID string, form *RegistrationConfig) error {
+	name := form.FormName()
+	form.Name = name
+
+	if name == DefaultFormName {
+		serverConfig, exists := GetServerConfig(guildID)
+		if !exists {
+			serverConfig = &ServerConfig{GuildID: guildID}
+		}
+		if err := SaveConfigToDB(guildID, serverConfig, form); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		registrationConfigs[guildID] = form
+		mu.Unlock()
+		return nil
+	}
+
+	configJSON, err := json.Marshal(form)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO registration_forms (guild_id, name, config_json, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
+		guildID, name, string(configJSON))
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	if registrationForms[guildID] == nil {
+		registrationForms[guildID] = make(map[string]*RegistrationConfig)
+	}
+	registrationForms[guildID][name] = form
+	mu.Unlock()
+	return nil
+}
+
+// Количество активных регистраций и участников в очереди по форме
+func formUsage(guildID, name string) (int, int) {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	active, queued := 0, 0
+	for _, session := range registeringUsers {
+		if session.GuildID == guildID && normalizeFormName(session.FormName) == name {
+			active++
+		}
+	}
+	for _, item := range getRegistrationQueue(guildID).items {
+		if normalizeFormName(item.form) == name {
+			queued++
+		}
+	}
+	return active, queued
+}
+
+// Удаление дополнительной формы регистрации.
+// Форму, по которой идут или ожидают регистрации, удалить нельзя: их сессии остались бы без вопросов
+func DeleteRegistrationForm(guildID, name string) error {
+	name = normalizeFormName(name)
+	if active, queued := formUsage(guildID, name); active > 0 || queued > 0 {
+		return invalidf("по форме %s идёт регистраций: %d, в очереди: %d. Дождитесь их завершения или прервите через !stopRegistred", name, active, queued)
+	}
+	if _, err := db.Exec("DELETE FROM registration_forms WHERE guild_id = ? AND name = ?", guildID, name); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	delete(registrationForms[guildID], name)
+	mu.Unlock()
+	return nil
+}
+
+// Обработка команды участника !register [form]
+func (sc *ServerConfig) handleSelfRegistration(s *discordgo.Session, m *discordgo.MessageCreate) {
+	forms := formsByTrigger(sc.GuildID, TriggerSelf)
+	if len(forms) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Самостоятельная регистрация на этом сервере недоступна")
+		return
+	}
+
+	var form *RegistrationConfig
+	args := strings.Fields(m.Content)
+	if len(args) > 1 {
+		name := normalizeFormName(args[1])
+		for _, candidate := range forms {
+			if candidate.FormName() == name {
+				form = candidate
+				break
+			}
+		}
+	} else if len(forms) == 1 {
+		form = forms[0]
+	}
+
+	if form == nil {
+		names := make([]string, 0, len(forms))
+		for _, candidate := range forms {
+			names = append(names, "`"+candidate.FormName()+"`")
+		}
+		s.ChannelMessageSend(m.ChannelID, "Укажите форму: `!register <name>`. Доступные формы: "+strings.Join(names, ", "))
+		return
+	}
+
+	mu.Lock()
+	_, inProgress := registeringUsers[sessionKey(sc.GuildID, m.Author.ID)]
+	mu.Unlock()
+	if inProgress {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("<@%s>, вы уже проходите регистрацию", m.Author.ID))
+		return
+	}
+
+	logger.Info("Пользователь ID:" + m.Author.ID + " запустил регистрацию по форме " + form.FormName())
+	position, added := sc.enqueueRegistration(s, queuedMember{
+		member: &discordgo.Member{GuildID: sc.GuildID, User: m.Author},
+		form:   form.FormName(),
+	})
+	switch {
+	case !added:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("<@%s>, вы уже в очереди или проходите регистрацию", m.Author.ID))
+	case position > 0:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf(
+			"<@%s>, вы в очереди на регистрацию по форме `%s` (позиция: %d)", m.Author.ID, form.FormName(), position))
+	default:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("<@%s>, регистрация по форме `%s` запущена", m.Author.ID, form.FormName()))
+	}
+}
+
+// Загрузка дополнительных форм регистрации из базы данных
+func loadFormsFromDB() error {
+	rows, err := db.Query("SELECT guild_id, name, config_json FROM registration_forms")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var guildID, name, configJSONStr string
+		if err := rows.Scan(&guildID, &name, &configJSONStr); err != nil {
+			return err
+		}
+
+		var form RegistrationConfig
+		if err := json.Unmarshal([]byte(configJSONStr), &form); err != nil {
+			logger.Error("Ошибка парсинга формы " + name + " для гильдии " + guildID + ": " + err.Error())
+			continue
+		}
+		form.Name = name
+
+		if registrationForms[guildID] == nil {
+			registrationForms[guildID] = make(map[string]*RegistrationConfig)
+		}
+		registrationForms[guildID][name] = &form
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Через сколько без ответа на heartbeat шлюз считается зависшим
+const heartbeatTimeout = 3 * time.Minute
+
+// Сколько бот может оставаться неработоспособным до перезапуска
+const watchdogTimeout = 5 * time.Minute
+
+// Признак того, что конфигурации серверов и форм загружены из БД
+var configsLoaded atomic.Bool
+
+// Ответ эндпоинтов /healthz и /readyz
+type healthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Проверка живости: состояние регистраций не заблокировано и шлюз получает ответы на heartbeat
+func livenessChecks(s *discordgo.Session) map[string]string {
+	checks := map[string]string{"heartbeat": "ok", "state": "ok"}
+
+	if !tryLockState(5 * time.Second) {
+		checks["state"] = "блокировка состояния регистраций удерживается слишком долго"
+	}
+
+	// До первого ответа на heartbeat бот ещё подключается
+	if !s.LastHeartbeatAck.IsZero() && time.Since(s.LastHeartbeatAck) > heartbeatTimeout {
+		checks["heartbeat"] = "нет ответа на heartbeat с " + s.LastHeartbeatAck.Format(time.RFC3339)
+	}
+	return checks
+}
+
+// Попытка захватить блокировку состояния регистраций за отведённое время
+func tryLockState(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if mu.TryLock() {
+			mu.Unlock()
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Все ли проверки прошли успешно
+func checksPassed(checks map[string]string) bool {
+	for _, result := range checks {
+		if result != "ok" {
+			return false
+		}
+	}
+	return true
+}
+
+// Проверка готовности: шлюз подключён, БД доступна, конфигурации загружены
+func readinessChecks(s *discordgo.Session) map[string]string {
+	checks := map[string]string{"gateway": "ok", "database": "ok", "configs": "ok"}
+
+	if !s.DataReady {
+		checks["gateway"] = "сессия шлюза не открыта"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if db == nil {
+		checks["database"] = "БД не инициализирована"
+	} else if err := db.PingContext(ctx); err != nil {
+		checks["database"] = err.Error()
+	}
+
+	if !configsLoaded.Load() {
+		checks["configs"] = "конфигурации не загружены"
+	}
+	return checks
+}
+
+// Обработчик эндпоинта проверки состояния
+func healthHandler(s *discordgo.Session, checks func(*discordgo.Session) map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Status: "ok", Checks: checks(s)}
+		if !checksPassed(report.Checks) {
+			report.Status = "fail"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// Запуск сторожа, останавливающего бота через cancel, если он долго не работает.
+// Бот завершается обычным путём, а политика restart в docker-compose перезапускает контейнер
+func StartWatchdog(ctx context.Context, s *discordgo.Session, cancel context.CancelFunc) {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		var failingSince time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			healthy := s.DataReady && checksPassed(livenessChecks(s))
+			if healthy {
+				failingSince = time.Time{}
+				continue
+			}
+
+			if failingSince.IsZero() {
+				failingSince = time.Now()
+				logger.Error("Бот не прошёл проверку состояния, ожидаем восстановления")
+				continue
+			}
+			if time.Since(failingSince) > watchdogTimeout {
+				logger.Error("Бот не работает дольше " + watchdogTimeout.String() + ", завершаем процесс для перезапуска")
+				cancel()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Запись итога регистрационной сессии в историю
+func recordRegistration(session *UserSession, outcome string) error {
+	observeRegistrationOutcome(session.GuildID, outcome)
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO registration_history (guild_id, user_id, outcome, session_json, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		session.GuildID, session.UserID, outcome, string(sessionJSON), session.StartedAt, time.Now().Unix())
+	return err
+}
+
+// Запись истории регистраций
+type historyEntry struct {
+	ID         int64
+	UserID     string
+	Outcome    string
+	Session    UserSession
+	StartedAt  int64
+	FinishedAt int64
+}
+
+// Отбор записей истории регистраций
+type historyFilter struct {
+	UserID  string
+	Outcome string
+	Since   int64 // finished_at, Unix-секунды
+	Limit   int
+}
+
+// Последние записи истории регистраций сервера
+func loadRegistrationHistory(guildID string, filter historyFilter) ([]historyEntry, error) {
+	query := `
+		SELECT id, user_id, outcome, session_json, started_at, finished_at FROM registration_history
+		WHERE guild_id = ?`
+	args := []any{guildID}
+	if filter.UserID != "" {
+		query += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.Outcome != "" {
+		query += " AND outcome = ?"
+		args = append(args, filter.Outcome)
+	}
+	if filter.Since > 0 {
+		query += " AND finished_at >= ?"
+		args = append(args, filter.Since)
+	}
+	query += " ORDER BY finished_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []historyEntry{}
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// Запись истории регистраций по ID. Возвращает nil, nil, если записи нет
+func loadHistoryEntry(guildID string, id int64) (*historyEntry, error) {
+	row := db.QueryRow(`
+		SELECT id, user_id, outcome, session_json, started_at, finished_at FROM registration_history
+		WHERE guild_id = ? AND id = ?`, guildID, id)
+
+	entry, err := scanHistoryEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// Чтение записи истории из строки результата запроса
+func scanHistoryEntry(row interface{ Scan(...any) error }) (*historyEntry, error) {
+	var entry historyEntry
+	var sessionJSON string
+	if err := row.Scan(&entry.ID, &entry.UserID, &entry.Outcome, &sessionJSON, &entry.StartedAt, &entry.FinishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sessionJSON), &entry.Session); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Запуск HTTP-сервера с метриками, проверками состояния, веб-панелью и API, если задан HTTP_ADDR (например, :9090).
+// Возвращает, запущен ли сервер
+func StartHTTPServer(s *discordgo.Session) bool {
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		return false
+	}
+
+	instrumentDiscordClient(s)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler(s))
+	mux.HandleFunc("/healthz", healthHandler(s, livenessChecks))
+	mux.HandleFunc("/readyz", healthHandler(s, readinessChecks))
+	registerAdminRoutes(mux, s)
+	registerAPIRoutes(mux, s)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("HTTP-сервер запущен на " + addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Ошибка HTTP-сервера: " + err.Error())
+		}
+	}()
+	return true
+}
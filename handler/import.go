@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Имя формы для участников, добавленных импортом
+const importFormName = "import"
+
+// Сколько строк с ошибками показывать в отчёте
+const maxImportProblemsShown = 15
+
+// Строка списка участников для импорта
+type rosterEntry struct {
+	Line       int
+	UserID     string
+	User       *discordgo.User
+	FamilyName string
+	RoleID     string
+	Problem    string
+}
+
+// Подготовленный импорт, ожидающий подтверждения
+type rosterImport struct {
+	AdminID   string
+	Entries   []rosterEntry
+	CreatedAt time.Time
+}
+
+var (
+	pendingImports = make(map[string]*rosterImport) // guild_id -> импорт
+	importsMu      sync.Mutex
+)
+
+// Сколько подготовленный импорт ждёт подтверждения
+const importTTL = 30 * time.Minute
+
+// Отмена подготовленного импорта
+func (sc *ServerConfig) cancelRosterImport(s *discordgo.Session, m *discordgo.MessageCreate) {
+	importsMu.Lock()
+	_, exists := pendingImports[sc.GuildID]
+	delete(pendingImports, sc.GuildID)
+	importsMu.Unlock()
+
+	if exists {
+		reply(s, m, "Импорт отменён")
+	} else {
+		reply(s, m, "Нет подготовленного импорта")
+	}
+}
+
+// Разбор CSV-файла и отчёт о том, что будет сделано (без изменений на сервере)
+func (sc *ServerConfig) prepareRosterImport(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if len(m.Attachments) == 0 || !strings.HasSuffix(strings.ToLower(m.Attachments[0].Filename), ".csv") {
+		reply(s, m, "Прикрепите CSV-файл с колонками `discord_id` или `username`, `family_name`, `role`")
+		return
+	}
+
+	data, err := downloadAttachment(m.Attachments[0])
+	if err != nil {
+		logger.Error("Ошибка загрузки файла: " + err.Error())
+		reply(s, m, "Ошибка загрузки файла: "+err.Error())
+		return
+	}
+
+	entries, err := sc.parseRoster(s, data)
+	if err != nil {
+		reply(s, m, "Ошибка разбора CSV: "+err.Error())
+		return
+	}
+
+	importsMu.Lock()
+	pendingImports[sc.GuildID] = &rosterImport{AdminID: m.Author.ID, Entries: entries, CreatedAt: time.Now()}
+	importsMu.Unlock()
+
+	ready, problems := 0, []string{}
+	for _, entry := range entries {
+		if entry.Problem != "" {
+			problems = append(problems, fmt.Sprintf("строка %d: %s", entry.Line, entry.Problem))
+		} else {
+			ready++
+		}
+	}
+
+	response := fmt.Sprintf("**Пробный импорт (изменения не применены)**\nСтрок: %d\nБудет отмечено зарегистрированными: %d\nС ошибками: %d\n",
+		len(entries), ready, len(problems))
+	for i, problem := range problems {
+		if i == maxImportProblemsShown {
+			response += fmt.Sprintf("...и ещё %d\n", len(problems)-maxImportProblemsShown)
+			break
+		}
+		response += problem + "\n"
+	}
+	response += "\nУчастникам будут выданы роли, установлены ники по фамилии и созданы профили. " +
+		"Для применения отправьте `!import apply`, для отмены - `!import cancel`"
+
+	reply(s, m, response)
+}
+
+// Разбор CSV со списком участников и сопоставление с участниками сервера
+func (sc *ServerConfig) parseRoster(s *discordgo.Session, data []byte) ([]rosterEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	_, hasID := columns["discord_id"]
+	_, hasUsername := columns["username"]
+	if !hasID && !hasUsername {
+		return nil, fmt.Errorf("нужна колонка discord_id или username")
+	}
+
+	members, err := fetchGuildMembers(s, sc.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.GuildRoles(sc.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*discordgo.Member)
+	byName := make(map[string]*discordgo.Member)
+	for _, member := range members {
+		byID[member.User.ID] = member
+		for _, name := range []string{member.User.Username, member.User.GlobalName, member.Nick} {
+			if name != "" {
+				byName[strings.ToLower(name)] = member
+			}
+		}
+	}
+
+	column := func(record []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	entries := []rosterEntry{}
+	seen := make(map[string]int) // user_id -> строка
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := rosterEntry{Line: line, FamilyName: column(record, "family_name")}
+
+		var member *discordgo.Member
+		if id := column(record, "discord_id"); id != "" {
+			member = byID[parseUserID(id)]
+		} else if username := column(record, "username"); username != "" {
+			member = byName[strings.ToLower(strings.TrimPrefix(username, "@"))]
+		}
+
+		if roleName := column(record, "role"); roleName != "" {
+			for _, role := range roles {
+				if role.ID == roleName || strings.EqualFold(role.Name, roleName) {
+					entry.RoleID = role.ID
+					break
+				}
+			}
+			if entry.RoleID == "" {
+				entry.Problem = "роль " + roleName + " не найдена"
+			}
+		}
+
+		switch {
+		case member == nil:
+			entry.Problem = "участник не найден на сервере"
+		case member.User.Bot:
+			entry.Problem = "боты не импортируются"
+		case seen[member.User.ID] != 0:
+			entry.Problem = fmt.Sprintf("участник уже указан в строке %d", seen[member.User.ID])
+		}
+
+		if member != nil {
+			entry.UserID = member.User.ID
+			entry.User = member.User
+			if seen[member.User.ID] == 0 {
+				seen[member.User.ID] = line
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Применение подготовленного импорта
+func (sc *ServerConfig) applyRosterImport(s *discordgo.Session, m *discordgo.MessageCreate) {
+	importsMu.Lock()
+	pending, exists := pendingImports[sc.GuildID]
+	if exists && time.Since(pending.CreatedAt) > importTTL {
+		delete(pendingImports, sc.GuildID)
+		exists = false
+	}
+	// Импорт массово выдаёт роли и ники, поэтому применить его может только подготовивший администратор
+	confirmed := exists && pending.AdminID == m.Author.ID
+	if confirmed {
+		delete(pendingImports, sc.GuildID)
+	}
+	importsMu.Unlock()
+
+	switch {
+	case !exists:
+		reply(s, m, "Нет подготовленного импорта. Сначала отправьте `!import roster` с CSV-файлом")
+		return
+	case !confirmed:
+		reply(s, m, "Импорт должен применить подготовивший его администратор")
+		return
+	}
+
+	reply(s, m, "Применяю импорт... Это может занять время")
+
+	registrationRoleID := findRoleID(s, sc.GuildID, sc.RegistrationRole)
+	imported, failed := 0, 0
+	for _, entry := range pending.Entries {
+		if entry.Problem != "" {
+			continue
+		}
+
+		mu.Lock()
+		_, inProgress := registeringUsers[sessionKey(sc.GuildID, entry.UserID)]
+		mu.Unlock()
+		if inProgress {
+			logger.Info("Пользователь ID:" + entry.UserID + " проходит регистрацию, импорт пропущен")
+			failed++
+			continue
+		}
+		sc.removeFromQueue(entry.UserID)
+
+		if err := sc.importMember(s, entry, registrationRoleID, pending.AdminID); err != nil {
+			logger.Error("Ошибка импорта пользователя " + entry.UserID + ": " + err.Error())
+			failed++
+		} else {
+			imported++
+		}
+
+		// Задержка для предотвращения лимитов
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	logger.Info(fmt.Sprintf("Импорт списка участников для сервера %s: импортировано %d, ошибок %d", sc.GuildID, imported, failed))
+	reply(s, m, fmt.Sprintf("Импорт завершён!\nИмпортировано: %d\nНе удалось: %d", imported, failed))
+}
+
+// Отметка участника зарегистрированным: профиль, роль, ник и запись о регистрации
+func (sc *ServerConfig) importMember(s *discordgo.Session, entry rosterEntry, registrationRoleID, adminID string) error {
+	session := &UserSession{
+		GuildID:    sc.GuildID,
+		UserID:     entry.UserID,
+		FormName:   importFormName,
+		ReviewerID: adminID,
+		Answers:    make(map[string]UserAnswer),
+		Data:       make(map[string]interface{}),
+		Profile:    make(map[string]string),
+		StartedAt:  time.Now().Unix(),
+	}
+
+	if entry.FamilyName != "" {
+		if err := saveProfileField(sc.GuildID, entry.UserID, "family_name", entry.FamilyName); err != nil {
+			return err
+		}
+		session.Data["family_name"] = entry.FamilyName
+		session.Profile["family_name"] = entry.FamilyName
+
+		if err := s.GuildMemberNickname(sc.GuildID, entry.UserID, entry.FamilyName); err != nil {
+			// Например, ник владельца сервера изменить нельзя
+			logger.Error("Ошибка изменения ника пользователя " + entry.UserID + ": " + err.Error())
+		}
+	}
+
+	if entry.RoleID != "" {
+		if err := s.GuildMemberRoleAdd(sc.GuildID, entry.UserID, entry.RoleID); err != nil {
+			return err
+		}
+	}
+
+	if registrationRoleID != "" {
+		_ = s.GuildMemberRoleRemove(sc.GuildID, entry.UserID, registrationRoleID)
+	}
+
+	if err := recordRegistration(session, OutcomeImported); err != nil {
+		return err
+	}
+	return sc.saveMemberRegistration(s, session)
+}
@@ -5,358 +5,872 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// Обработка команды инициализации
-func handleInitCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID string) {
-	// Проверка прав администратора
-	if !IsAdmin(s, m) {
-		logger.Warn("Попытка пользователя использовать команды")
-		s.ChannelMessageSend(m.ChannelID, "У вас недостаточно прав для выполнения этой команды")
+// Команда настройки сервера и её подкоманды
+func initCommand() *commandSpec {
+	roleArg := func(description string) commandArg {
+		return commandArg{Name: "role", Description: description, Kind: argRole, Required: true}
+	}
+	formArg := commandArg{Name: "name", Description: "Имя формы", Kind: argForm, Required: true}
+	triggers := []string{TriggerJoin, TriggerPanel, TriggerAdmin, TriggerSelf}
+
+	return &commandSpec{
+		Name:        "init",
+		Description: "Настройка сервера",
+		Details: "Права в каналах регистрации: " + strings.Join(permissionNames(), ", ") + " (через запятую)\n\n" +
+			"**Как получить ID:**\n1. Включите режим разработчика в Discord (Настройки > Расширенные)\n2. ПКМ на элементе сервера/роли/канала > Копировать ID",
+		Group:   "init",
+		Setup:   true,
+		Audited: true,
+		Slash:   "init",
+		Subcommands: []*commandSpec{
+			{Name: "show", Description: "Показать текущую конфигурацию", Run: (*ServerConfig).handleInitShow},
+			{Name: "guild", Description: "Установить ID сервера", PrefixOnly: true, AdminOnly: true, Run: (*ServerConfig).handleInitGuild,
+				Args: []commandArg{{Name: "server_id", Description: "ID сервера", Required: true}}},
+			{Name: "role", Description: "Установить роль регистрации", Run: (*ServerConfig).handleInitRole,
+				Args: []commandArg{roleArg("Роль, выдаваемая на время регистрации")}},
+			{Name: "category", Description: "Установить категорию для каналов регистрации", Run: (*ServerConfig).handleInitCategory,
+				Args: []commandArg{{Name: "category", Description: "Категория", Kind: argCategory, Required: true}}},
+			{Name: "overflow", Description: "Дополнительные категории, заполняемые после основной", Run: (*ServerConfig).handleInitOverflow,
+				Args: []commandArg{{Name: "categories", Description: "ID категорий через запятую, clear - очистить", Required: true}}},
+			{Name: "channel_name", Description: "Шаблон названия канала регистрации", Run: (*ServerConfig).handleInitChannelName,
+				Args: []commandArg{{Name: "template", Description: "Например reg-{username}-{short_id}, default - по умолчанию", Required: true, Rest: true}}},
+			{Name: "channel", Description: "Установить канал для команд", Run: (*ServerConfig).handleInitChannel,
+				Args: []commandArg{{Name: "channel", Description: "Канал для команд", Kind: argChannel, Required: true}}},
+			{Name: "preserved", Description: "Роли, которые не снимает !clsRoles", PrefixOnly: true, Run: (*ServerConfig).handleInitPreserved,
+				Args: []commandArg{{Name: "roles", Description: "ID или упоминания ролей через запятую, clear - очистить", Required: true, Rest: true}}},
+			{Name: "guild_role", Description: "Установить роль для согильдийцев", Run: (*ServerConfig).handleInitGuildRole,
+				Args: []commandArg{roleArg("Роль согильдийца")}},
+			{Name: "friend_role", Description: "Установить роль для друзей", Run: (*ServerConfig).handleInitFriendRole,
+				Args: []commandArg{roleArg("Роль друга")}},
+			{Name: "staff_role", Description: "Роль персонала, которой видны каналы регистрации", Run: (*ServerConfig).handleInitStaffRole,
+				Args: []commandArg{roleArg("Роль персонала"), {Name: "permissions", Description: "Права через запятую"}}},
+			{Name: "staff_role_remove", Description: "Убрать роль персонала", Run: (*ServerConfig).handleInitStaffRoleRemove,
+				Args: []commandArg{roleArg("Роль персонала")}},
+			{Name: "applicant_perms", Description: "Права участника в своём канале регистрации", Run: (*ServerConfig).handleInitApplicantPerms,
+				Args: []commandArg{{Name: "permissions", Description: "Права через запятую, default - по умолчанию", Required: true}}},
+			{Name: "channel_policy", Description: "Что делать с каналом после регистрации", Run: (*ServerConfig).handleInitChannelPolicy,
+				Args: []commandArg{
+					{Name: "policy", Description: "Политика", Required: true, Choices: []string{ChannelPolicyDelete, ChannelPolicyArchive, ChannelPolicyKeep}},
+					{Name: "delay_seconds", Description: "Задержка в секундах", Kind: argInteger},
+				}},
+			{Name: "archive", Description: "Архивная категория и срок хранения архива", Run: (*ServerConfig).handleInitArchive,
+				Args: []commandArg{
+					{Name: "category", Description: "Архивная категория", Kind: argCategory, Required: true},
+					{Name: "retention_days", Description: "Срок хранения в днях, 0 - бессрочно", Kind: argInteger},
+				}},
+			{Name: "returning", Description: "Поведение при повторном входе зарегистрированного участника", Run: (*ServerConfig).handleInitReturning,
+				Args: []commandArg{{Name: "policy", Description: "Политика", Required: true, Choices: []string{ReturningReregister, ReturningConfirm, ReturningAutoRestore}}}},
+			{Name: "queue", Description: "Лимит одновременных регистраций", Run: (*ServerConfig).handleInitQueue,
+				Args: []commandArg{{Name: "max", Description: "Количество регистраций", Kind: argInteger, Required: true}}},
+			{Name: "raid", Description: "Порог наплыва участников (raid 0 0 - выключить)", Run: (*ServerConfig).handleInitRaid,
+				Args: []commandArg{
+					{Name: "joins", Description: "Входов за окно, 0 - выключить", Kind: argInteger, Required: true},
+					{Name: "seconds", Description: "Окно в секундах", Kind: argInteger, Required: true},
+					{Name: "pause_minutes", Description: "Пауза в минутах", Kind: argInteger},
+				}},
+			{Name: "load_server", Description: "Загрузить конфигурацию сервера (ServerConfig)", Attachment: "JSON-файл конфигурации сервера", Run: (*ServerConfig).handleInitLoadServer},
+			{Name: "load_registration", Description: "Загрузить основную форму регистрации (RegistrationConfig)", Attachment: "JSON-файл формы", Run: (*ServerConfig).handleInitLoadRegistration},
+			{Name: "load_form", Description: "Загрузить дополнительную форму регистрации", Attachment: "JSON-файл формы", Run: (*ServerConfig).handleInitLoadForm,
+				Args: []commandArg{formArg, {Name: "trigger", Description: "Способ запуска", Choices: triggers}}},
+			{Name: "form_trigger", Description: "Изменить способ запуска формы", Run: (*ServerConfig).handleInitFormTrigger,
+				Args: []commandArg{formArg, {Name: "trigger", Description: "Способ запуска", Required: true, Choices: triggers}}},
+			{Name: "remove_form", Description: "Удалить дополнительную форму", Run: (*ServerConfig).handleInitRemoveForm,
+				Args: []commandArg{formArg}},
+			{Name: "forms", Description: "Список форм регистрации", Run: (*ServerConfig).handleInitForms},
+			{Name: "panel", Description: "Разместить панель с кнопками регистрации", Run: (*ServerConfig).handleInitPanel,
+				Args: []commandArg{{Name: "channel", Description: "Канал для панели, без канала или remove - убрать панель", Kind: argChannel}}},
+			{Name: "mode", Description: "Начинать регистрацию при входе или только кнопкой на панели", Run: (*ServerConfig).handleInitMode,
+				Args: []commandArg{{Name: "mode", Description: "Режим", Required: true, Choices: []string{RegistrationModeAuto, RegistrationModePanel}}}},
+			{Name: "audit_channel", Description: "Дублировать журнал аудита в канал", Run: (*ServerConfig).handleInitAuditChannel,
+				Args: []commandArg{{Name: "channel", Description: "Канал, без канала или remove - отключить", Kind: argChannel}}},
+		},
+	}
+}
+
+// Обработка команды !init guild
+func (sc *ServerConfig) handleInitGuild(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	// Обновляем GuildID
+	newGuildID := call.Args[0]
+	sc.GuildID = newGuildID
+
+	// Сохраняем в БД с новым GuildID
+	regConfig, _ := GetRegistrationConfig(newGuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
+
+	if err := SaveConfigToDB(newGuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
 		return
 	}
-	
-	args := strings.Fields(m.Content)
-	if len(args) < 2 {
-		showInitHelp(s, m.ChannelID)
+
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[newGuildID] = sc
+	mu.Unlock()
+
+	reply(s, m, "ID сервера установлен: "+newGuildID)
+}
+
+// Обработка команды !init role
+func (sc *ServerConfig) handleInitRole(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.RegistrationRole = call.Args[0]
+
+	// Сохраняем изменения в БД
+	regConfig, _ := GetRegistrationConfig(sc.GuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
+
+	if err := SaveConfigToDB(sc.GuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
 		return
 	}
 
-	// Получаем текущую конфигурацию сервера, если есть
-	serverConfig, exists := GetServerConfig(guildID)
-	if !exists {
-		// Создаем новую конфигурацию
-		serverConfig = &ServerConfig{GuildID: guildID}
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[sc.GuildID] = sc
+	mu.Unlock()
+
+	reply(s, m, "ID роли регистрации установлен: "+call.Args[0])
+}
+
+// Обработка команды !init category
+func (sc *ServerConfig) handleInitCategory(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.CategoryID = call.Args[0]
+
+	// Сохраняем изменения в БД
+	regConfig, _ := GetRegistrationConfig(sc.GuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
 	}
 
-	switch args[1] {
-	case "guild":
-		logger.Info("Запуск команды !init guild")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID сервера: `!init guild <server_id>`")
-			return
-		}
-		
-		// Обновляем GuildID
-		newGuildID := args[2]
-		serverConfig.GuildID = newGuildID
-		
-		// Сохраняем в БД с новым GuildID
-		regConfig, _ := GetRegistrationConfig(newGuildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+	if err := SaveConfigToDB(sc.GuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		if err := SaveConfigToDB(newGuildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
-		}
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[sc.GuildID] = sc
+	mu.Unlock()
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[newGuildID] = serverConfig
-		mu.Unlock()
+	reply(s, m, "ID категории установлен: "+call.Args[0])
+}
 
-		s.ChannelMessageSend(m.ChannelID, "ID сервера установлен: " + newGuildID)
+// Обработка команды !init channel
+func (sc *ServerConfig) handleInitChannel(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.CommandChannelID = call.Args[0]
 
-	case "role":
-		logger.Info("Запуск команды !init role")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID роли регистрации: `!init role <role_id>`")
-			return
-		}
-		serverConfig.RegistrationRole = args[2]
-		
-		// Сохраняем изменения в БД
-		regConfig, _ := GetRegistrationConfig(guildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+	// Сохраняем изменения в БД
+	regConfig, _ := GetRegistrationConfig(sc.GuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
 
-		if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
-		}
+	if err := SaveConfigToDB(sc.GuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[guildID] = serverConfig
-		mu.Unlock()
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[sc.GuildID] = sc
+	mu.Unlock()
 
-		s.ChannelMessageSend(m.ChannelID, "ID роли регистрации установлен: " + args[2])
+	reply(s, m, "ID канала команд установлен: "+call.Args[0])
+}
 
-	case "category":
-		logger.Info("Запуск команды !init category")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID категории: `!init category <category_id>`")
-			return
-		}
-		serverConfig.CategoryID = args[2]
-		
-		// Сохраняем изменения в БД
-		regConfig, _ := GetRegistrationConfig(guildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+// Обработка команды !init guild_role
+func (sc *ServerConfig) handleInitGuildRole(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.GuildRoleId = call.Args[0]
 
-		if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
-		}
+	// Сохраняем изменения в БД
+	regConfig, _ := GetRegistrationConfig(sc.GuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[guildID] = serverConfig
-		mu.Unlock()
+	if err := SaveConfigToDB(sc.GuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		s.ChannelMessageSend(m.ChannelID, "ID категории установлен: " + args[2])
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[sc.GuildID] = sc
+	mu.Unlock()
 
-	case "channel":
-		logger.Info("Запуск команды !init channel")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID канала команд: `!init channel <channel_id>`")
-			return
-		}
-		serverConfig.CommandChannelID = args[2]
-		
-		// Сохраняем изменения в БД
-		regConfig, _ := GetRegistrationConfig(guildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+	reply(s, m, "ID роли согильдийца установлен: "+call.Args[0])
+}
 
-		if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
-		}
+// Обработка команды !init friend_role
+func (sc *ServerConfig) handleInitFriendRole(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.FriendRoleId = call.Args[0]
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[guildID] = serverConfig
-		mu.Unlock()
+	// Сохраняем изменения в БД
+	regConfig, _ := GetRegistrationConfig(sc.GuildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
 
-		s.ChannelMessageSend(m.ChannelID, "ID канала команд установлен: " + args[2])
+	if err := SaveConfigToDB(sc.GuildID, sc, regConfig); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-	case "guild_role":
-		logger.Info("Запуск команды !init guild_role")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID роли согильдийца: `!init guild_role <role_id>`")
-			return
-		}
-		serverConfig.GuildRoleId = args[2]
-		
-		// Сохраняем изменения в БД
-		regConfig, _ := GetRegistrationConfig(guildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+	// Обновляем в памяти
+	mu.Lock()
+	serverConfigs[sc.GuildID] = sc
+	mu.Unlock()
 
-		if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
-		}
+	reply(s, m, "ID роли друга установлен: "+call.Args[0])
+}
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[guildID] = serverConfig
-		mu.Unlock()
+// Обработка команды !init returning
+func (sc *ServerConfig) handleInitReturning(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.ReturningPolicy = strings.ToLower(call.Args[0])
 
-		s.ChannelMessageSend(m.ChannelID, "ID роли согильдийца установлен: " + args[2])
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-	case "friend_role":
-		logger.Info("Запуск команды !init friend_role")
-		if len(args) < 3 {
-			s.ChannelMessageSend(m.ChannelID, "Укажите ID роли друга: `!init friend_role <role_id>`")
-			return
-		}
-		serverConfig.FriendRoleId = args[2]
-		
-		// Сохраняем изменения в БД
-		regConfig, _ := GetRegistrationConfig(guildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
-		}
+	reply(s, m, "Политика для вернувшихся участников установлена: "+sc.ReturningPolicy)
+}
 
-		if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
-			return
+// Обработка команды !init overflow
+func (sc *ServerConfig) handleInitOverflow(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.OverflowCategoryIDs = nil
+	if strings.ToLower(call.Args[0]) != "clear" {
+		for _, categoryID := range strings.Split(call.Args[0], ",") {
+			if categoryID = strings.TrimSpace(categoryID); categoryID != "" {
+				sc.OverflowCategoryIDs = append(sc.OverflowCategoryIDs, categoryID)
+			}
 		}
+	}
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[guildID] = serverConfig
-		mu.Unlock()
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		s.ChannelMessageSend(m.ChannelID, "ID роли друга установлен: " + args[2])
+	reply(s, m, "Дополнительные категории установлены: "+strings.Join(sc.OverflowCategoryIDs, ", "))
+}
 
-	case "load_server":
-		logger.Info("Запуск команды !init load_server")
-		if len(m.Attachments) == 0 {
-			s.ChannelMessageSend(m.ChannelID, "Прикрепите JSON-файл с конфигурацией сервера (ServerConfig)")
-			return
+// Обработка команды !init preserved
+func (sc *ServerConfig) handleInitPreserved(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	preservedRoles := []string{}
+	if strings.ToLower(call.Args[0]) != "clear" {
+		for _, roleID := range strings.FieldsFunc(call.Args[0], func(r rune) bool { return r == ',' || r == ' ' }) {
+			if findRoleID(s, sc.GuildID, parseRoleID(roleID)) == "" {
+				reply(s, m, "Роль `"+roleID+"` не найдена на сервере")
+				return
+			}
+			preservedRoles = append(preservedRoles, parseRoleID(roleID))
 		}
+	}
+	sc.PreservedRoles = preservedRoles
 
-		attachment := m.Attachments[0]
-		if !strings.HasSuffix(attachment.Filename, ".json") {
-			s.ChannelMessageSend(m.ChannelID, "Файл должен быть в формате JSON")
-			return
-		}
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		// Скачиваем файл
-		resp, err := http.Get(attachment.URL)
-		if err != nil {
-			logger.Error("Ошибка загрузки файла: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка загрузки файла: "+err.Error())
-			return
-		}
-		defer resp.Body.Close()
+	reply(s, m, "Сохраняемые роли установлены: "+formatRoleList(sc.PreservedRoles))
+}
+
+// Обработка команды !init channel_name
+func (sc *ServerConfig) handleInitChannelName(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	template := call.Args[0]
+	if strings.ToLower(template) == "default" {
+		template = ""
+	}
+	sc.ChannelNameTemplate = template
+
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		// Читаем содержимое
-		data, err := io.ReadAll(resp.Body)
+	example := sc.registrationChannelName(m.Author)
+	reply(s, m, "Шаблон названия канала установлен. Пример: `"+example+"`")
+}
+
+// Обработка команды !init staff_role
+func (sc *ServerConfig) handleInitStaffRole(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	staffRole := StaffRole{RoleID: call.Args[0]}
+	if len(call.Args) > 1 {
+		permissions, err := parsePermissionNames(call.Args[1])
 		if err != nil {
-			logger.Error("Ошибка чтения файла: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка чтения файла: "+err.Error())
+			reply(s, m, "Ошибка: "+err.Error())
 			return
 		}
+		staffRole.Permissions = permissions
+	}
 
-		// Парсим JSON
-		var loadedConfig ServerConfig
-		if err := json.Unmarshal(data, &loadedConfig); err != nil {
-			logger.Error("Ошибка парсинга JSON: "+err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка парсинга JSON: "+err.Error())
-			return
+	// Повторное добавление роли заменяет её права
+	staffRoles := []StaffRole{}
+	for _, existing := range sc.StaffRoles {
+		if existing.RoleID != staffRole.RoleID {
+			staffRoles = append(staffRoles, existing)
 		}
+	}
+	sc.StaffRoles = append(staffRoles, staffRole)
 
-		// Если GuildID не установлен в загруженной конфигурации, берем его из контекста
-		if loadedConfig.GuildID == "" {
-			loadedConfig.GuildID = guildID
-		}
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Роль персонала <@&%s> добавлена", staffRole.RoleID))
+}
 
-		// Устанавливаем значения из загруженной конфигурации
-		serverConfig.GuildID = loadedConfig.GuildID
-		serverConfig.RegistrationRole = loadedConfig.RegistrationRole
-		serverConfig.CategoryID = loadedConfig.CategoryID
-		serverConfig.CommandChannelID = loadedConfig.CommandChannelID
-		serverConfig.GuildRoleId = loadedConfig.GuildRoleId
-		serverConfig.FriendRoleId = loadedConfig.FriendRoleId
-
-		// Получаем или создаем RegistrationConfig
-		regConfig, _ := GetRegistrationConfig(serverConfig.GuildID)
-		if regConfig == nil {
-			regConfig = &RegistrationConfig{Version: "1.0"}
+// Обработка команды !init staff_role_remove
+func (sc *ServerConfig) handleInitStaffRoleRemove(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	staffRoles := []StaffRole{}
+	for _, existing := range sc.StaffRoles {
+		if existing.RoleID != call.Args[0] {
+			staffRoles = append(staffRoles, existing)
 		}
+	}
+	if len(staffRoles) == len(sc.StaffRoles) {
+		reply(s, m, fmt.Sprintf("Роль <@&%s> не является ролью персонала", call.Args[0]))
+		return
+	}
+	sc.StaffRoles = staffRoles
 
-		// Сохраняем в БД
-		if err := SaveConfigToDB(serverConfig.GuildID, serverConfig, regConfig); err != nil {
-			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Роль персонала <@&%s> удалена", call.Args[0]))
+}
+
+// Обработка команды !init applicant_perms
+func (sc *ServerConfig) handleInitApplicantPerms(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if strings.ToLower(call.Args[0]) == "default" {
+		sc.ApplicantPermissions = nil
+	} else {
+		permissions, err := parsePermissionNames(call.Args[0])
+		if err != nil {
+			reply(s, m, "Ошибка: "+err.Error())
 			return
 		}
+		sc.ApplicantPermissions = permissions
+	}
 
-		// Обновляем в памяти
-		mu.Lock()
-		serverConfigs[serverConfig.GuildID] = serverConfig
-		mu.Unlock()
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
 
-		logger.Info("ServerConfig загружен и сохранен для сервера: " + serverConfig.GuildID)
-		s.ChannelMessageSend(m.ChannelID, "Конфигурация сервера загружена и сохранена для сервера: " + serverConfig.GuildID)
-		showCurrentConfig(s, m.ChannelID, serverConfig)
+	reply(s, m, "Права участника в канале регистрации установлены: "+strings.Join(sc.applicantPermissionNames(), ", "))
+}
 
-	case "load_registration":
-		logger.Info("Запуск команды !init load_registration")
-		if len(m.Attachments) == 0 {
-			s.ChannelMessageSend(m.ChannelID, "Прикрепите JSON-файл с конфигурацией регистрации (RegistrationConfig)")
+// Обработка команды !init channel_policy
+func (sc *ServerConfig) handleInitChannelPolicy(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	policy := strings.ToLower(call.Args[0])
+	if policy == ChannelPolicyArchive && sc.ArchiveCategoryID == "" {
+		reply(s, m, "Сначала укажите архивную категорию: `!init archive <category_id> [retention_days]`")
+		return
+	}
+	delay := sc.ChannelDeleteDelay
+	if len(call.Args) > 1 {
+		var err error
+		delay, err = strconv.Atoi(call.Args[1])
+		if err != nil || delay < 0 {
+			reply(s, m, "Задержка должна быть неотрицательным числом секунд")
 			return
 		}
+	}
 
-		attachment := m.Attachments[0]
-		if !strings.HasSuffix(attachment.Filename, ".json") {
-			s.ChannelMessageSend(m.ChannelID, "Файл должен быть в формате JSON")
+	// Изменяем копию, чтобы при ошибке сохранения конфигурация в памяти не расходилась с БД
+	updated := *sc
+	updated.ChannelPolicy = policy
+	updated.ChannelDeleteDelay = delay
+	if err := saveServerConfig(updated.GuildID, &updated); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, "Политика для каналов завершённой регистрации установлена: "+updated.ChannelPolicy)
+}
+
+// Обработка команды !init archive
+func (sc *ServerConfig) handleInitArchive(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	days := sc.ArchiveRetentionDays
+	if len(call.Args) > 1 {
+		var err error
+		days, err = strconv.Atoi(call.Args[1])
+		if err != nil || days < 0 {
+			reply(s, m, "Срок хранения должен быть неотрицательным числом дней")
 			return
 		}
+	}
 
-		// Скачиваем файл
-		resp, err := http.Get(attachment.URL)
-		if err != nil {
-			logger.Error("Ошибка загрузки файла: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка загрузки файла: "+err.Error())
+	updated := *sc
+	updated.ArchiveCategoryID = call.Args[0]
+	updated.ArchiveRetentionDays = days
+	if err := saveServerConfig(updated.GuildID, &updated); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Архивная категория установлена: %s, срок хранения: %d дн.",
+		updated.ArchiveCategoryID, updated.ArchiveRetentionDays))
+}
+
+// Обработка команды !init queue
+func (sc *ServerConfig) handleInitQueue(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	maxRegistrations, err := strconv.Atoi(call.Args[0])
+	if err != nil || maxRegistrations < 0 {
+		reply(s, m, "Лимит должен быть неотрицательным числом")
+		return
+	}
+	sc.MaxConcurrentRegistrations = maxRegistrations
+
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Лимит одновременных регистраций установлен: %d", sc.maxConcurrentRegistrations()))
+}
+
+// Обработка команды !init raid
+func (sc *ServerConfig) handleInitRaid(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	values := make([]int, 0, 3)
+	for _, arg := range call.Args[:min(len(call.Args), 3)] {
+		value, err := strconv.Atoi(arg)
+		if err != nil || value < 0 {
+			reply(s, m, "Параметры наплыва должны быть неотрицательными числами")
 			return
 		}
-		defer resp.Body.Close()
+		values = append(values, value)
+	}
+	sc.RaidJoinLimit = values[0]
+	sc.RaidWindowSeconds = values[1]
+	if len(values) > 2 {
+		sc.RaidPauseMinutes = values[2]
+	}
 
-		// Читаем содержимое
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			logger.Error("Ошибка чтения файла: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка чтения файла: "+err.Error())
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	if sc.RaidJoinLimit == 0 {
+		reply(s, m, "Обнаружение наплыва участников выключено")
+	} else {
+		reply(s, m, fmt.Sprintf("Наплыв: более %d входов за %s, пауза %s",
+			sc.RaidJoinLimit, sc.raidWindow(), sc.raidPause()))
+	}
+}
+
+// Обработка команды !init load_server
+func (sc *ServerConfig) handleInitLoadServer(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if len(m.Attachments) == 0 {
+		reply(s, m, "Прикрепите JSON-файл с конфигурацией сервера (ServerConfig)")
+		return
+	}
+
+	data, err := readJSONAttachment(m)
+	if err != nil {
+		logger.Error("Ошибка загрузки файла: " + err.Error())
+		reply(s, m, "Ошибка загрузки файла: "+err.Error())
+		return
+	}
+
+	// Парсим JSON
+	var loadedConfig ServerConfig
+	if err := json.Unmarshal(data, &loadedConfig); err != nil {
+		logger.Error("Ошибка парсинга JSON: " + err.Error())
+		reply(s, m, "Ошибка парсинга JSON: "+err.Error())
+		return
+	}
+
+	// Конфигурация загружается только для текущего сервера
+	if loadedConfig.GuildID != "" && loadedConfig.GuildID != sc.GuildID {
+		reply(s, m, "guild_id в файле не совпадает с этим сервером")
+		return
+	}
+	loadedConfig.GuildID = sc.GuildID
+
+	// Проверяем и сохраняем загруженную конфигурацию
+	byAdmin := IsAdmin(s, m)
+	sc, err = updateServerConfig(sc, &loadedConfig, byAdmin)
+	if err != nil {
+		reportSaveError(s, m, err)
+		return
+	}
+	if !byAdmin && loadedConfig.CommandPermissions != nil {
+		reply(s, m, "`command_permissions` из файла не применены: права на команды меняет только администратор через `!perms`")
+	}
+
+	refreshPanelAfterChange(s, m, sc)
+
+	logger.Info("ServerConfig загружен и сохранен для сервера: " + sc.GuildID)
+	reply(s, m, "Конфигурация сервера загружена и сохранена для сервера: "+sc.GuildID)
+	showCurrentConfig(s, m, sc)
+}
+
+// Обработка команды !init load_registration
+func (sc *ServerConfig) handleInitLoadRegistration(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if len(m.Attachments) == 0 {
+		reply(s, m, "Прикрепите JSON-файл с конфигурацией регистрации (RegistrationConfig)")
+		return
+	}
+
+	data, err := readJSONAttachment(m)
+	if err != nil {
+		logger.Error("Ошибка загрузки файла: " + err.Error())
+		reply(s, m, "Ошибка загрузки файла: "+err.Error())
+		return
+	}
+
+	// Парсим JSON
+	var regConfig RegistrationConfig
+	if err := json.Unmarshal(data, &regConfig); err != nil {
+		logger.Error("Ошибка парсинга JSON: " + err.Error())
+		reply(s, m, "Ошибка парсинга JSON: "+err.Error())
+		return
+	}
+
+	// Файл основной формы
+	regConfig.Name = DefaultFormName
+	if err := updateRegistrationForm(sc.GuildID, &regConfig); err != nil {
+		reportSaveError(s, m, err)
+		return
+	}
+
+	logger.Info("RegistrationConfig загружен и сохранен для сервера: " + sc.GuildID)
+	reply(s, m, "Конфигурация регистрации загружена и сохранена для сервера: "+sc.GuildID)
+	refreshPanelAfterChange(s, m, sc)
+}
+
+// Обработка команды !init load_form
+func (sc *ServerConfig) handleInitLoadForm(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	data, err := readJSONAttachment(m)
+	if err != nil {
+		logger.Error("Ошибка загрузки файла: " + err.Error())
+		reply(s, m, "Ошибка загрузки файла: "+err.Error())
+		return
+	}
+
+	var form RegistrationConfig
+	if err := json.Unmarshal(data, &form); err != nil {
+		logger.Error("Ошибка парсинга JSON: " + err.Error())
+		reply(s, m, "Ошибка парсинга JSON: "+err.Error())
+		return
+	}
+	form.Name = normalizeFormName(call.Args[0])
+	if len(call.Args) > 1 {
+		form.Trigger = strings.ToLower(call.Args[1])
+	}
+	if form.Trigger != "" && !isValidTrigger(form.Trigger) {
+		reply(s, m, "Неизвестный способ запуска формы: "+form.Trigger+". Доступны: join, panel, admin, self")
+		return
+	}
+	if err := updateRegistrationForm(sc.GuildID, &form); err != nil {
+		reportSaveError(s, m, err)
+		return
+	}
+
+	logger.Info("Форма " + form.Name + " загружена и сохранена для сервера: " + sc.GuildID)
+	reply(s, m, fmt.Sprintf("Форма `%s` загружена (запуск: %s, вопросов: %d)",
+		form.Name, form.FormTrigger(), len(form.Questions)))
+	refreshPanelAfterChange(s, m, sc)
+}
+
+// Обработка команды !init form_trigger
+func (sc *ServerConfig) handleInitFormTrigger(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	form, exists := GetRegistrationForm(sc.GuildID, call.Args[0])
+	if !exists {
+		reply(s, m, "Форма `"+normalizeFormName(call.Args[0])+"` не найдена")
+		return
+	}
+	form.Trigger = strings.ToLower(call.Args[1])
+
+	if err := SaveRegistrationForm(sc.GuildID, form); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Форма `%s` теперь запускается: %s", form.FormName(), form.Trigger))
+	refreshPanelAfterChange(s, m, sc)
+}
+
+// Обработка команды !init remove_form
+func (sc *ServerConfig) handleInitRemoveForm(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	name := normalizeFormName(call.Args[0])
+	if name == DefaultFormName {
+		reply(s, m, "Основную форму нельзя удалить, загрузите новую через `!init load_registration`")
+		return
+	}
+	if _, exists := GetRegistrationForm(sc.GuildID, name); !exists {
+		reply(s, m, "Форма `"+name+"` не найдена")
+		return
+	}
+
+	if err := DeleteRegistrationForm(sc.GuildID, name); err != nil {
+		if isValidationError(err) {
+			reply(s, m, "Форму нельзя удалить: "+err.Error())
 			return
 		}
+		logger.Error("Ошибка удаления формы: " + err.Error())
+		reply(s, m, "Ошибка удаления формы: "+err.Error())
+		return
+	}
 
-		// Парсим JSON
-		var regConfig RegistrationConfig
-		if err := json.Unmarshal(data, &regConfig); err != nil {
-			logger.Error("Ошибка парсинга JSON: "+err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка парсинга JSON: "+err.Error())
-			return
+	reply(s, m, "Форма `"+name+"` удалена")
+	refreshPanelAfterChange(s, m, sc)
+}
+
+// Обработка команды !init panel
+func (sc *ServerConfig) handleInitPanel(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if len(call.Args) == 0 || strings.ToLower(call.Args[0]) == "remove" {
+		if sc.PanelChannelID != "" && sc.PanelMessageID != "" {
+			_ = s.ChannelMessageDelete(sc.PanelChannelID, sc.PanelMessageID)
 		}
+		sc.PanelChannelID = ""
+		sc.PanelMessageID = ""
 
-		// Сохраняем в БД
-		if err := SaveConfigToDB(guildID, serverConfig, &regConfig); err != nil {
+		if err := saveServerConfig(sc.GuildID, sc); err != nil {
 			logger.Error("Ошибка сохранения в БД: " + err.Error())
-			s.ChannelMessageSend(m.ChannelID, "Ошибка сохранения в БД: "+err.Error())
+			reply(s, m, "Ошибка сохранения в БД: "+err.Error())
 			return
 		}
+		reply(s, m, "Панель регистрации удалена")
+		return
+	}
+
+	// Принимаем как упоминание канала, так и его ID
+	channelID := strings.TrimSuffix(strings.TrimPrefix(call.Args[0], "<#"), ">")
+
+	// Панель переносится в новый канал, старое сообщение удаляем
+	if sc.PanelMessageID != "" && sc.PanelChannelID != channelID {
+		_ = s.ChannelMessageDelete(sc.PanelChannelID, sc.PanelMessageID)
+		sc.PanelMessageID = ""
+	}
+	sc.PanelChannelID = channelID
+
+	if err := sc.refreshPanel(s); err != nil {
+		logger.Error("Ошибка создания панели регистрации: " + err.Error())
+		reply(s, m, "Ошибка создания панели регистрации: "+err.Error())
+		return
+	}
 
-		// Обновляем в памяти
-		mu.Lock()
-		registrationConfigs[guildID] = &regConfig
-		mu.Unlock()
+	reply(s, m, fmt.Sprintf("Панель регистрации размещена в канале <#%s>", channelID))
+}
 
-		logger.Info("RegistrationConfig загружен и сохранен для сервера: " + guildID)
-		s.ChannelMessageSend(m.ChannelID, "Конфигурация регистрации загружена и сохранена для сервера: " + guildID)
+// Обработка команды !init mode
+func (sc *ServerConfig) handleInitMode(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	sc.RegistrationMode = strings.ToLower(call.Args[0])
 
-	case "show":
-		logger.Info("Запуск команды !init show")
-		showCurrentConfig(s, m.ChannelID, serverConfig)
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
 		return
+	}
+
+	response := "Режим регистрации установлен: " + sc.RegistrationMode
+	if sc.RegistrationMode == RegistrationModePanel && sc.PanelChannelID == "" {
+		response += "\nНе забудьте разместить панель: `!init panel #channel`"
+	}
+	reply(s, m, response)
+}
+
+// Обработка команды !init audit_channel
+func (sc *ServerConfig) handleInitAuditChannel(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	response := "Журнал аудита больше не дублируется в канал"
+	if len(call.Args) == 0 || strings.ToLower(call.Args[0]) == "remove" {
+		sc.AuditChannelID = ""
+	} else {
+		sc.AuditChannelID = parseChannelID(call.Args[0])
+		response = fmt.Sprintf("Журнал аудита дублируется в канал <#%s>", sc.AuditChannelID)
+	}
+
+	if err := saveServerConfig(sc.GuildID, sc); err != nil {
+		logger.Error("Ошибка сохранения в БД: " + err.Error())
+		reply(s, m, "Ошибка сохранения в БД: "+err.Error())
+		return
+	}
+	reply(s, m, response)
+}
+
+// Обработка команды !init forms
+func (sc *ServerConfig) handleInitForms(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	forms := ListRegistrationForms(sc.GuildID)
+	if len(forms) == 0 {
+		reply(s, m, "Формы регистрации не загружены")
+		return
+	}
+
+	response := "**Формы регистрации:**\n"
+	for _, form := range forms {
+		response += fmt.Sprintf("` %s ` - запуск: %s, вопросов: %d\n", form.FormName(), form.FormTrigger(), len(form.Questions))
+	}
+	reply(s, m, response)
+}
+
+// Обработка команды !init show
+func (sc *ServerConfig) handleInitShow(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	showCurrentConfig(s, m, sc)
+}
+
+// Загрузка содержимого прикреплённого JSON-файла
+func readJSONAttachment(m *discordgo.MessageCreate) ([]byte, error) {
+	if len(m.Attachments) == 0 {
+		return nil, fmt.Errorf("прикрепите JSON-файл")
+	}
+
+	attachment := m.Attachments[0]
+	if !strings.HasSuffix(attachment.Filename, ".json") {
+		return nil, fmt.Errorf("файл должен быть в формате JSON")
+	}
+
+	return downloadAttachment(attachment)
+}
 
-	default:
-		showInitHelp(s, m.ChannelID)
+// Скачивание прикреплённого файла
+func downloadAttachment(attachment *discordgo.MessageAttachment) ([]byte, error) {
+	resp, err := http.Get(attachment.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Иначе страница ошибки попала бы в разбор JSON или CSV
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер Discord вернул %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Обновление панели регистрации после изменения конфигурации
+func refreshPanelAfterChange(s *discordgo.Session, m *discordgo.MessageCreate, serverConfig *ServerConfig) {
+	if err := serverConfig.refreshPanel(s); err != nil {
+		logger.Error("Ошибка обновления панели регистрации: " + err.Error())
+		reply(s, m, "Ошибка обновления панели регистрации: "+err.Error())
+	}
+}
+
+// Перенос настроек из загруженной конфигурации сервера
+func (sc *ServerConfig) applyServerConfig(loaded *ServerConfig) {
+	sc.GuildID = loaded.GuildID
+	sc.RegistrationRole = loaded.RegistrationRole
+	sc.CategoryID = loaded.CategoryID
+	sc.CommandChannelID = loaded.CommandChannelID
+	sc.GuildRoleId = loaded.GuildRoleId
+	sc.FriendRoleId = loaded.FriendRoleId
+	sc.ReturningPolicy = loaded.ReturningPolicy
+	sc.MaxConcurrentRegistrations = loaded.MaxConcurrentRegistrations
+	sc.RaidJoinLimit = loaded.RaidJoinLimit
+	sc.RaidWindowSeconds = loaded.RaidWindowSeconds
+	sc.RaidPauseMinutes = loaded.RaidPauseMinutes
+	sc.OverflowCategoryIDs = loaded.OverflowCategoryIDs
+	sc.ChannelNameTemplate = loaded.ChannelNameTemplate
+	sc.StaffRoles = loaded.StaffRoles
+	sc.ApplicantPermissions = loaded.ApplicantPermissions
+	sc.ChannelPolicy = loaded.ChannelPolicy
+	sc.ChannelDeleteDelay = loaded.ChannelDeleteDelay
+	sc.ArchiveCategoryID = loaded.ArchiveCategoryID
+	sc.ArchiveRetentionDays = loaded.ArchiveRetentionDays
+	sc.RegistrationMode = loaded.RegistrationMode
+	sc.AuditChannelID = loaded.AuditChannelID
+	if loaded.PreservedRoles != nil {
+		sc.PreservedRoles = loaded.PreservedRoles
+	}
+	if loaded.PanelChannelID != sc.PanelChannelID {
+		sc.PanelChannelID = loaded.PanelChannelID
+		sc.PanelMessageID = ""
+	}
+}
+
+// Проверка и сохранение загруженной конфигурации сервера.
+// Общая для !init load_server, веб-панели и API.
+// Права на команды переносятся только от администратора и только если они есть в файле,
+// иначе роль с доступом к !init могла бы выдать себе любые команды в обход !perms
+func updateServerConfig(serverConfig, loaded *ServerConfig, byAdmin bool) (*ServerConfig, error) {
+	if err := validateServerConfig(loaded); err != nil {
+		return nil, err
+	}
+
+	updated := *serverConfig
+	updated.applyServerConfig(loaded)
+	if byAdmin && loaded.CommandPermissions != nil {
+		updated.CommandPermissions = loaded.CommandPermissions
+	}
+	if err := saveServerConfig(updated.GuildID, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Проверка и сохранение формы регистрации.
+// Общая для !init load_registration, !init load_form, веб-панели и API
+func updateRegistrationForm(guildID string, form *RegistrationConfig) error {
+	if err := validateRegistrationForm(form); err != nil {
+		return err
+	}
+	return SaveRegistrationForm(guildID, form)
+}
+
+// Сообщение об ошибке проверки или сохранения конфигурации
+func reportSaveError(s *discordgo.Session, m *discordgo.MessageCreate, err error) {
+	if isValidationError(err) {
+		reply(s, m, "Ошибка в конфигурации: "+err.Error())
 		return
 	}
+	logger.Error("Ошибка сохранения в БД: " + err.Error())
+	reply(s, m, "Ошибка сохранения в БД: "+err.Error())
 }
 
-// Показать справку по команде !init
-func showInitHelp(s *discordgo.Session, channelID string) {
-	help := `**Команда настройки сервера:**
-!init guild <server_id> - Установить ID сервера
-!init role <role_id> - Установить ID роли регистрации
-!init category <category_id> - Установить ID категории для каналов
-!init channel <channel_id> - Установить ID канала для команд
-!init guild_role <role_id> - Установка роли для согильдийцев
-!init friend_role <role_id> - Установка роли для друзей
-!init load_server <json file> - Загрузить конфигурацию сервера (ServerConfig)
-!init load_registration <json file> - Загрузить конфигурацию регистрации (RegistrationConfig)
-!init show - Показать текущую конфигурацию
+// Сохранение конфигурации сервера в БД и в памяти
+func saveServerConfig(guildID string, serverConfig *ServerConfig) error {
+	regConfig, _ := GetRegistrationConfig(guildID)
+	if regConfig == nil {
+		regConfig = &RegistrationConfig{Version: "1.0"}
+	}
 
-**Как получить ID:**
-1. Включите режим разработчика в Discord (Настройки > Расширенные)
-2. ПКМ на элементе сервера/роли/канала > Копировать ID`
+	if err := SaveConfigToDB(guildID, serverConfig, regConfig); err != nil {
+		return err
+	}
 
-	s.ChannelMessageSend(channelID, help)
+	mu.Lock()
+	serverConfigs[guildID] = serverConfig
+	mu.Unlock()
+	return nil
 }
 
 // Показать текущую конфигурацию
-func showCurrentConfig(s *discordgo.Session, channelID string, sc *ServerConfig) {
+func showCurrentConfig(s *discordgo.Session, m *discordgo.MessageCreate, sc *ServerConfig) {
 	response := "**Текущая конфигурация:**\n"
 	if len(sc.GuildID) == 0 {
 		response += "Сервер (GuildID): ` Не установлено `\n"
@@ -366,9 +880,52 @@ func showCurrentConfig(s *discordgo.Session, channelID string, sc *ServerConfig)
 	}
 	response += fmt.Sprintf("Роль регистрации: <@&%s>\n", sc.RegistrationRole)
 	response += fmt.Sprintf("Категория каналов: ` %s `\n", sc.CategoryID)
+	if len(sc.OverflowCategoryIDs) > 0 {
+		response += fmt.Sprintf("Дополнительные категории: ` %s `\n", strings.Join(sc.OverflowCategoryIDs, ", "))
+	}
+	channelNameTemplate := sc.ChannelNameTemplate
+	if channelNameTemplate == "" {
+		channelNameTemplate = defaultChannelNameTemplate
+	}
+	response += fmt.Sprintf("Шаблон названия канала: ` %s `\n", channelNameTemplate)
+	response += fmt.Sprintf("Каналы после регистрации: ` %s через %s `\n", sc.channelPolicy(), sc.channelCloseDelay())
+	if sc.ArchiveCategoryID != "" {
+		response += fmt.Sprintf("Архивная категория: ` %s `, срок хранения: ` %d дн. `\n", sc.ArchiveCategoryID, sc.ArchiveRetentionDays)
+	}
+	response += fmt.Sprintf("Права участника в канале: ` %s `\n", strings.Join(sc.applicantPermissionNames(), ", "))
+	for _, staffRole := range sc.StaffRoles {
+		permissions := staffRole.Permissions
+		if len(permissions) == 0 {
+			permissions = defaultStaffPermissions
+		}
+		response += fmt.Sprintf("Роль персонала: <@&%s> ` %s `\n", staffRole.RoleID, strings.Join(permissions, ", "))
+	}
 	response += fmt.Sprintf("Канал команд: ` %s `\n", sc.CommandChannelID)
+	if len(sc.PreservedRoles) > 0 {
+		response += "Сохраняемые роли: " + formatRoleList(sc.PreservedRoles) + "\n"
+	}
 	response += fmt.Sprintf("Роль Согильдийца: <@&%s>\n", sc.GuildRoleId)
 	response += fmt.Sprintf("Роль друга: <@&%s>\n", sc.FriendRoleId)
 
-	s.ChannelMessageSend(channelID, response)
+	returningPolicy := sc.ReturningPolicy
+	if returningPolicy == "" {
+		returningPolicy = ReturningReregister
+	}
+	response += fmt.Sprintf("Вернувшиеся участники: ` %s `\n", returningPolicy)
+	response += fmt.Sprintf("Режим регистрации: ` %s `\n", sc.registrationMode())
+	if sc.PanelChannelID != "" {
+		response += fmt.Sprintf("Панель регистрации: <#%s>\n", sc.PanelChannelID)
+	}
+	response += fmt.Sprintf("Одновременных регистраций: ` %d `\n", sc.maxConcurrentRegistrations())
+	if sc.RaidJoinLimit > 0 {
+		response += fmt.Sprintf("Наплыв: ` более %d входов за %s, пауза %s `\n",
+			sc.RaidJoinLimit, sc.raidWindow(), sc.raidPause())
+	} else {
+		response += "Наплыв: ` не отслеживается `\n"
+	}
+	if sc.AuditChannelID != "" {
+		response += fmt.Sprintf("Журнал аудита: <#%s>\n", sc.AuditChannelID)
+	}
+
+	reply(s, m, response)
 }
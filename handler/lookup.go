@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Количество результатов поиска на одной странице
+const searchPageSize = 10
+
+// Найденный участник
+type searchResult struct {
+	UserID string
+	Field  string
+	Value  string
+	Source string
+}
+
+// Обработка команды !whois <@user|user_id>
+func (sc *ServerConfig) handleWhoisCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	userID := call.Args[0]
+
+	registration, err := loadMemberRegistration(sc.GuildID, userID)
+	if err != nil {
+		logger.Error("Ошибка загрузки регистрации: " + err.Error())
+		reply(s, m, "Ошибка загрузки регистрации: "+err.Error())
+		return
+	}
+	profile, err := loadMemberProfile(sc.GuildID, userID)
+	if err != nil {
+		logger.Error("Ошибка загрузки профиля: " + err.Error())
+		reply(s, m, "Ошибка загрузки профиля: "+err.Error())
+		return
+	}
+	lastOutcome, lastFinishedAt, err := loadLastOutcome(sc.GuildID, userID)
+	if err != nil {
+		logger.Error("Ошибка загрузки истории регистрации: " + err.Error())
+	}
+
+	if registration == nil && len(profile) == 0 && lastOutcome == "" {
+		reply(s, m, fmt.Sprintf("О пользователе <@%s> нет данных регистрации", userID))
+		return
+	}
+
+	response := fmt.Sprintf("**Пользователь <@%s>**\n", userID)
+	if registration != nil {
+		response += fmt.Sprintf("Форма: ` %s `\n", normalizeFormName(registration.Session.FormName))
+		response += fmt.Sprintf("Регистрация завершена: ` %s `\n", formatTimestamp(registration.CompletedAt))
+		if registration.Session.ReviewerID != "" {
+			response += fmt.Sprintf("Проверяющий: <@%s>\n", registration.Session.ReviewerID)
+		} else {
+			response += "Проверяющий: ` - `\n"
+		}
+	} else {
+		response += "Регистрация: ` не завершена `\n"
+	}
+	if lastOutcome != "" {
+		response += fmt.Sprintf("Последняя сессия: ` %s, %s `\n", lastOutcome, formatTimestamp(lastFinishedAt))
+	}
+
+	if registration != nil && len(registration.Session.Answers) > 0 {
+		response += "\n**Ответы:**\n"
+		form, _ := GetRegistrationForm(sc.GuildID, registration.Session.FormName)
+		response += formatAnswers(registration.Session.Answers, form)
+	}
+
+	if len(profile) > 0 {
+		response += "\n**Профиль:**\n" + formatProfile(profile)
+	}
+
+	reply(s, m, response)
+}
+
+// Обработка команды !search field=value [--page N]
+func (sc *ServerConfig) handleSearchCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	page := 1
+	if value, err := strconv.Atoi(call.Flag("page")); err == nil && value > 0 {
+		page = value
+	}
+
+	field, value, found := strings.Cut(call.Args[0], "=")
+	field = strings.TrimSpace(field)
+	value = strings.TrimSpace(value)
+	if !found || field == "" || value == "" {
+		reply(s, m, "Укажите поле и значение: `!search field=value [--page N]`")
+		return
+	}
+
+	results, err := searchMembers(sc.GuildID, field, value)
+	if err != nil {
+		logger.Error("Ошибка поиска: " + err.Error())
+		reply(s, m, "Ошибка поиска: "+err.Error())
+		return
+	}
+
+	if len(results) == 0 {
+		reply(s, m, fmt.Sprintf("По запросу `%s=%s` ничего не найдено", field, value))
+		return
+	}
+
+	pages := (len(results) + searchPageSize - 1) / searchPageSize
+	if page > pages {
+		page = pages
+	}
+	start := (page - 1) * searchPageSize
+	end := min(start+searchPageSize, len(results))
+
+	response := fmt.Sprintf("**Результаты поиска `%s=%s`** (найдено: %d, страница %d из %d)\n",
+		field, value, len(results), page, pages)
+	for _, result := range results[start:end] {
+		response += fmt.Sprintf("<@%s> - %s: ` %s ` (%s)\n", result.UserID, result.Field, result.Value, result.Source)
+	}
+	if page < pages {
+		response += fmt.Sprintf("\nСледующая страница: `!search %s=%s --page %d`", field, value, page+1)
+	}
+
+	reply(s, m, response)
+}
+
+// Поиск участников по профилям и записям регистраций.
+// Имя поля сравнивается без учёта регистра, значение ищется как подстрока без учёта регистра
+func searchMembers(guildID, field, value string) ([]searchResult, error) {
+	needle := strings.ToLower(value)
+	matches := func(candidate string) bool {
+		return strings.Contains(strings.ToLower(candidate), needle)
+	}
+
+	results := []searchResult{}
+	seen := make(map[string]bool)
+	add := func(result searchResult) {
+		if seen[result.UserID] {
+			return
+		}
+		seen[result.UserID] = true
+		results = append(results, result)
+	}
+
+	// Профили участников
+	rows, err := db.Query("SELECT user_id, fields_json FROM member_profiles WHERE guild_id = ?", guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, fieldsJSON string
+		if err := rows.Scan(&userID, &fieldsJSON); err != nil {
+			return nil, err
+		}
+		profile := make(map[string]string)
+		if err := json.Unmarshal([]byte(fieldsJSON), &profile); err != nil {
+			continue
+		}
+		for key, fieldValue := range profile {
+			if strings.EqualFold(key, field) && matches(fieldValue) {
+				add(searchResult{UserID: userID, Field: key, Value: fieldValue, Source: "профиль"})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Записи регистраций, начиная с последних
+	historyRows, err := db.Query(`
+		SELECT user_id, outcome, session_json, finished_at FROM registration_history
+		WHERE guild_id = ? ORDER BY finished_at DESC, id DESC`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer historyRows.Close()
+
+	for historyRows.Next() {
+		var userID, outcome, sessionJSON string
+		var finishedAt int64
+		if err := historyRows.Scan(&userID, &outcome, &sessionJSON, &finishedAt); err != nil {
+			return nil, err
+		}
+		var session UserSession
+		if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+			continue
+		}
+
+		source := fmt.Sprintf("регистрация %s, %s", outcome, formatTimestamp(finishedAt))
+		for questionID, answer := range session.Answers {
+			if !strings.EqualFold(questionID, field) {
+				continue
+			}
+			for _, candidate := range answerValues(answer) {
+				if matches(candidate) {
+					add(searchResult{UserID: userID, Field: questionID, Value: formatAnswer(answer), Source: source})
+					break
+				}
+			}
+		}
+		for key, dataValue := range session.Data {
+			if str, ok := dataValue.(string); ok && strings.EqualFold(key, field) && matches(str) {
+				add(searchResult{UserID: userID, Field: key, Value: str, Source: source})
+			}
+		}
+	}
+
+	return results, historyRows.Err()
+}
+
+// Все текстовые представления ответа: значение, ID и текст выбранного варианта
+func answerValues(answer UserAnswer) []string {
+	values := []string{fmt.Sprint(answer.Value)}
+	if answer.Selected != nil {
+		values = append(values, answer.Selected.ID, answer.Selected.Text)
+	}
+	return values
+}
+
+// Вопрос и ответ участника
+type answerLine struct {
+	Question string
+	Answer   string
+}
+
+// Ответы в порядке вопросов формы. Ответы на вопросы, которых нет в форме, выводятся по ID
+func orderedAnswers(answers map[string]UserAnswer, form *RegistrationConfig) []answerLine {
+	lines := []answerLine{}
+	shown := make(map[string]bool)
+	if form != nil {
+		for _, question := range form.Questions {
+			answer, exists := answers[question.ID]
+			if !exists {
+				continue
+			}
+			shown[question.ID] = true
+			lines = append(lines, answerLine{Question: question.Text, Answer: formatAnswer(answer)})
+		}
+	}
+
+	rest := []string{}
+	for questionID := range answers {
+		if !shown[questionID] {
+			rest = append(rest, questionID)
+		}
+	}
+	sort.Strings(rest)
+	for _, questionID := range rest {
+		lines = append(lines, answerLine{Question: questionID, Answer: formatAnswer(answers[questionID])})
+	}
+	return lines
+}
+
+// Ответы в порядке вопросов формы для сообщения в Discord
+func formatAnswers(answers map[string]UserAnswer, form *RegistrationConfig) string {
+	response := ""
+	for _, line := range orderedAnswers(answers, form) {
+		response += fmt.Sprintf("%s - ` %s `\n", line.Question, line.Answer)
+	}
+	return response
+}
+
+// Последний итог регистрационной сессии участника
+func loadLastOutcome(guildID, userID string) (string, int64, error) {
+	var outcome string
+	var finishedAt int64
+	err := db.QueryRow(`
+		SELECT outcome, finished_at FROM registration_history
+		WHERE guild_id = ? AND user_id = ? ORDER BY finished_at DESC, id DESC LIMIT 1`,
+		guildID, userID).Scan(&outcome, &finishedAt)
+	if err == sql.ErrNoRows {
+		return "", 0, nil
+	}
+	return outcome, finishedAt, err
+}
+
+// Форматирование времени в Unix-секундах
+func formatTimestamp(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("02.01.2006 15:04")
+}
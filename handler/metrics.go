@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Счётчик Prometheus с набором меток
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // значения меток через \xff -> значение
+}
+
+// Создание счётчика
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// Увеличение счётчика для значений меток
+func (c *counterVec) inc(labelValues ...string) {
+	c.add(1, labelValues...)
+}
+
+// Увеличение счётчика на value для значений меток
+func (c *counterVec) add(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	c.values[key] += value
+	c.mu.Unlock()
+}
+
+// Запись счётчика в текстовом формате Prometheus
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, strings.Split(key, "\xff")), c.values[key])
+	}
+}
+
+// Форматирование меток вида {name="value"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Запись метрики-показателя в текстовом формате Prometheus
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
+
+var (
+	registrationsStarted = newCounterVec("discord_bot_registrations_started_total",
+		"Начатые регистрационные сессии", "guild")
+	registrationsCompleted = newCounterVec("discord_bot_registrations_completed_total",
+		"Успешно завершённые регистрации", "guild")
+	registrationsFailed = newCounterVec("discord_bot_registrations_failed_total",
+		"Незавершённые регистрации по причине (abandoned, rejected, error)", "guild", "reason")
+	discordAPIErrors = newCounterVec("discord_bot_discord_api_errors_total",
+		"Ошибки вызовов Discord API по эндпоинту", "endpoint")
+	actionFailures = newCounterVec("discord_bot_action_failures_total",
+		"Ошибки выполнения действий регистрации по типу", "type")
+	commandsExecuted = newCounterVec("discord_bot_commands_total",
+		"Вызовы команд по итогу (ok, denied, not_configured)", "command", "result")
+	commandDuration = newCounterVec("discord_bot_command_duration_seconds_total",
+		"Суммарное время выполнения команд", "command")
+)
+
+// Учёт итога регистрации в метриках
+func observeRegistrationOutcome(guildID, outcome string) {
+	switch outcome {
+	case OutcomeCompleted:
+		registrationsCompleted.inc(guildID)
+	case OutcomeAbandoned, OutcomeRejected:
+		registrationsFailed.inc(guildID, outcome)
+	}
+}
+
+// Обработчик /metrics
+func metricsHandler(s *discordgo.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		// Настроенные серверы без сессий отдают 0, чтобы ряд не пропадал
+		activeSessions := make(map[string]int)
+		ForEachServerConfig(func(guildID string, config *ServerConfig) {
+			activeSessions[guildID] = 0
+		})
+		mu.Lock()
+		for _, session := range registeringUsers {
+			activeSessions[session.GuildID]++
+		}
+		mu.Unlock()
+
+		fmt.Fprintf(w, "# HELP discord_bot_active_sessions Активные регистрационные сессии\n# TYPE discord_bot_active_sessions gauge\n")
+		guilds := make([]string, 0, len(activeSessions))
+		for guildID := range activeSessions {
+			guilds = append(guilds, guildID)
+		}
+		sort.Strings(guilds)
+		for _, guildID := range guilds {
+			fmt.Fprintf(w, "discord_bot_active_sessions%s %d\n", formatLabels([]string{"guild"}, []string{guildID}), activeSessions[guildID])
+		}
+
+		registrationsStarted.write(w)
+		registrationsCompleted.write(w)
+		registrationsFailed.write(w)
+		discordAPIErrors.write(w)
+		actionFailures.write(w)
+		commandsExecuted.write(w)
+		commandDuration.write(w)
+
+		// До первого ответа на heartbeat задержка не определена
+		if !s.LastHeartbeatAck.IsZero() {
+			writeGauge(w, "discord_bot_heartbeat_latency_seconds", "Задержка heartbeat шлюза Discord", s.HeartbeatLatency().Seconds())
+		}
+		writeGauge(w, "discord_bot_goroutines", "Количество горутин", float64(runtime.NumGoroutine()))
+	}
+}
+
+// Транспорт HTTP-клиента discordgo, считающий ошибки Discord API
+type discordAPITransport struct {
+	next http.RoundTripper
+}
+
+// Выполнение запроса с учётом ошибок
+func (t *discordAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode >= 400 {
+		discordAPIErrors.inc(req.Method + " " + discordEndpoint(req.URL.Path))
+	}
+	return resp, err
+}
+
+// Подключение учёта ошибок Discord API к сессии
+func instrumentDiscordClient(s *discordgo.Session) {
+	if s.Client == nil {
+		s.Client = &http.Client{}
+	}
+	next := s.Client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if _, instrumented := next.(*discordAPITransport); !instrumented {
+		s.Client.Transport = &discordAPITransport{next: next}
+	}
+}
+
+// Эндпоинт Discord API без ID и токенов, например guilds/:id/members/:id
+func discordEndpoint(path string) string {
+	path = strings.TrimPrefix(path, "/api/v"+discordgo.APIVersion+"/")
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case segment != "" && strings.Trim(segment, "0123456789") == "":
+			segments[i] = ":id"
+		case len(segment) > 32:
+			segments[i] = ":token"
+		}
+	}
+	return strings.Join(segments, "/")
+}
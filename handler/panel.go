@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Режимы запуска регистрации новых участников
+const (
+	RegistrationModeAuto  = "auto"  // регистрация начинается при входе на сервер (по умолчанию)
+	RegistrationModePanel = "panel" // только кнопкой на панели регистрации
+)
+
+// Префикс идентификатора кнопки панели, за ним следует имя формы
+const panelButtonPrefix = "registration_panel:"
+
+// Ограничения Discord на кнопки в одном сообщении
+const (
+	maxButtonsPerRow = 5
+	maxPanelButtons  = 25
+)
+
+// Проверка корректности режима регистрации
+func isValidRegistrationMode(mode string) bool {
+	return mode == RegistrationModeAuto || mode == RegistrationModePanel
+}
+
+// Режим регистрации с учётом значения по умолчанию
+func (sc *ServerConfig) registrationMode() string {
+	if sc.RegistrationMode == "" {
+		return RegistrationModeAuto
+	}
+	return sc.RegistrationMode
+}
+
+// Формы, которые можно запустить с панели
+func panelForms(guildID string) []*RegistrationConfig {
+	forms := []*RegistrationConfig{}
+	for _, form := range ListRegistrationForms(guildID) {
+		trigger := form.FormTrigger()
+		if trigger == TriggerPanel || trigger == TriggerJoin {
+			forms = append(forms, form)
+		}
+	}
+	if len(forms) > maxPanelButtons {
+		forms = forms[:maxPanelButtons]
+	}
+	return forms
+}
+
+// Название формы для участников
+func (rc *RegistrationConfig) DisplayTitle() string {
+	if rc.Title != "" {
+		return rc.Title
+	}
+	return rc.FormName()
+}
+
+// Содержимое сообщения панели регистрации
+func (sc *ServerConfig) panelMessage() (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	forms := panelForms(sc.GuildID)
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Регистрация на сервере",
+		Description: "Нажмите кнопку ниже, чтобы начать регистрацию. Бот создаст для вас приватный канал с вопросами.",
+		Color:       0x5865F2,
+	}
+	if len(forms) == 0 {
+		embed.Description = "Регистрация сейчас недоступна."
+	}
+
+	components := []discordgo.MessageComponent{}
+	var row discordgo.ActionsRow
+	for _, form := range forms {
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    form.DisplayTitle(),
+			Style:    discordgo.PrimaryButton,
+			CustomID: panelButtonPrefix + form.FormName(),
+		})
+		if len(row.Components) == maxButtonsPerRow {
+			components = append(components, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		components = append(components, row)
+	}
+
+	return embed, components
+}
+
+// Создание или обновление панели регистрации.
+// Если сообщение панели удалено, оно создаётся заново
+func (sc *ServerConfig) refreshPanel(s *discordgo.Session) error {
+	if sc.PanelChannelID == "" {
+		return nil
+	}
+
+	embed, components := sc.panelMessage()
+
+	if sc.PanelMessageID != "" {
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         sc.PanelMessageID,
+			Channel:    sc.PanelChannelID,
+			Embeds:     &[]*discordgo.MessageEmbed{embed},
+			Components: &components,
+		})
+		if err == nil {
+			return nil
+		}
+		// Заново создаём панель, только если сообщение удалено, иначе при временной
+		// ошибке в канале появилась бы вторая панель
+		var restErr *discordgo.RESTError
+		if !errors.As(err, &restErr) || restErr.Message == nil || restErr.Message.Code != discordgo.ErrCodeUnknownMessage {
+			return err
+		}
+		logger.Warn("Сообщение панели регистрации удалено, создаём заново")
+	}
+
+	message, err := s.ChannelMessageSendComplex(sc.PanelChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		return err
+	}
+
+	sc.PanelMessageID = message.ID
+	return saveServerConfig(sc.GuildID, sc)
+}
+
+// Обновление панелей регистрации всех серверов, например после перезапуска
+func RefreshPanels(s *discordgo.Session) {
+	configs := []*ServerConfig{}
+	ForEachServerConfig(func(guildID string, config *ServerConfig) {
+		configs = append(configs, config)
+	})
+
+	for _, config := range configs {
+		if err := config.refreshPanel(s); err != nil {
+			logger.Error("Ошибка обновления панели регистрации для гильдии " + config.GuildID + ": " + err.Error())
+		}
+	}
+}
+
+// Обработка взаимодействий с сообщениями бота
+func (sc *ServerConfig) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent || i.Member == nil {
+		return
+	}
+
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, panelButtonPrefix) {
+		return
+	}
+
+	sc.handlePanelButton(s, i, strings.TrimPrefix(customID, panelButtonPrefix))
+}
+
+// Запуск регистрации по нажатию кнопки панели
+func (sc *ServerConfig) handlePanelButton(s *discordgo.Session, i *discordgo.InteractionCreate, formName string) {
+	user := i.Member.User
+
+	form, exists := GetRegistrationForm(sc.GuildID, formName)
+	if !exists || (form.FormTrigger() != TriggerPanel && form.FormTrigger() != TriggerJoin) {
+		respondEphemeral(s, i, "Эта форма регистрации больше недоступна")
+		return
+	}
+
+	mu.Lock()
+	session, inProgress := registeringUsers[sessionKey(sc.GuildID, user.ID)]
+	mu.Unlock()
+	if inProgress {
+		respondEphemeral(s, i, fmt.Sprintf("Вы уже проходите регистрацию: <#%s>", session.ChannelID))
+		return
+	}
+
+	// Зарегистрированный участник не может пройти форму входа повторно
+	if form.FormTrigger() == TriggerJoin {
+		registration, err := loadMemberRegistration(sc.GuildID, user.ID)
+		if err != nil {
+			logger.Error("Ошибка загрузки регистрации участника: " + err.Error())
+			respondEphemeral(s, i, "Не удалось проверить вашу регистрацию, попробуйте позже")
+			return
+		}
+		if registration != nil && registration.matchesForm(form) {
+			respondEphemeral(s, i, "Вы уже зарегистрированы на сервере")
+			return
+		}
+	}
+
+	logger.Info("Пользователь ID:" + user.ID + " запустил регистрацию с панели по форме " + form.FormName())
+	respondEphemeral(s, i, "Регистрация запущена, приватный канал появится через несколько секунд")
+
+	// Нажатие кнопки приравнивается ко входу: во время наплыва такие регистрации ждут в очереди
+	sc.enqueueRegistration(s, queuedMember{
+		member: &discordgo.Member{GuildID: sc.GuildID, User: user},
+		form:   form.FormName(),
+		auto:   true,
+	})
+}
+
+// Ответ на взаимодействие, видимый только нажавшему
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logger.Error("Ошибка ответа на взаимодействие: " + err.Error())
+	}
+}
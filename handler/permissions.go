@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Права в каналах регистрации, которые можно настроить
+var channelPermissions = map[string]int64{
+	"view":            discordgo.PermissionViewChannel,
+	"send":            discordgo.PermissionSendMessages,
+	"read_history":    discordgo.PermissionReadMessageHistory,
+	"manage_messages": discordgo.PermissionManageMessages,
+	"attach_files":    discordgo.PermissionAttachFiles,
+	"embed_links":     discordgo.PermissionEmbedLinks,
+	"add_reactions":   discordgo.PermissionAddReactions,
+}
+
+// Права по умолчанию
+var (
+	defaultApplicantPermissions = []string{"view", "send", "read_history"}
+	defaultStaffPermissions     = []string{"view", "send", "read_history"}
+)
+
+// Роль персонала, которой видны каналы регистрации
+type StaffRole struct {
+	RoleID      string   `json:"role_id"`
+	Permissions []string `json:"permissions"` // view, send, read_history, manage_messages, ...
+}
+
+// Разбор списка прав через запятую
+func parsePermissionNames(value string) ([]string, error) {
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, exists := channelPermissions[name]; !exists {
+			return nil, fmt.Errorf("неизвестное право %q, доступны: %s", name, strings.Join(permissionNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Список всех настраиваемых прав
+func permissionNames() []string {
+	names := make([]string, 0, len(channelPermissions))
+	for name := range channelPermissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Битовая маска прав по их названиям
+func permissionMask(names []string) int64 {
+	var mask int64
+	for _, name := range names {
+		mask |= channelPermissions[name]
+	}
+	return mask
+}
+
+// Маска всех настраиваемых прав
+func allChannelPermissions() int64 {
+	var mask int64
+	for _, permission := range channelPermissions {
+		mask |= permission
+	}
+	return mask
+}
+
+// Права участника в канале регистрации с учётом значений по умолчанию
+func (sc *ServerConfig) applicantPermissionNames() []string {
+	if len(sc.ApplicantPermissions) == 0 {
+		return defaultApplicantPermissions
+	}
+	return sc.ApplicantPermissions
+}
+
+// Права участника в его канале регистрации. Всё, что не разрешено явно, запрещается
+func (sc *ServerConfig) applicantOverwrite(userID string) *discordgo.PermissionOverwrite {
+	// Без просмотра канал регистрации бесполезен
+	allow := permissionMask(sc.applicantPermissionNames()) | discordgo.PermissionViewChannel
+
+	return &discordgo.PermissionOverwrite{
+		ID:    userID,
+		Type:  discordgo.PermissionOverwriteTypeMember,
+		Allow: allow,
+		Deny:  allChannelPermissions() &^ allow,
+	}
+}
+
+// Права ролей персонала в каналах регистрации
+func (sc *ServerConfig) staffOverwrites() []*discordgo.PermissionOverwrite {
+	overwrites := []*discordgo.PermissionOverwrite{}
+	for _, staffRole := range sc.StaffRoles {
+		names := staffRole.Permissions
+		if len(names) == 0 {
+			names = defaultStaffPermissions
+		}
+		// Персонал без просмотра не увидел бы канал, как и участник
+		overwrites = append(overwrites, &discordgo.PermissionOverwrite{
+			ID:    staffRole.RoleID,
+			Type:  discordgo.PermissionOverwriteTypeRole,
+			Allow: permissionMask(names) | discordgo.PermissionViewChannel,
+		})
+	}
+	return overwrites
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Хранилища для действия save_answer
+const (
+	StorageSession   = "session"   // значение живёт, пока идёт регистрация
+	StoragePermanent = "permanent" // значение сохраняется в профиль участника
+)
+
+// Допустимое имя поля профиля: оно подставляется в JSON-путь SQLite
+var profileFieldPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Сохранение поля в постоянный профиль участника
+func saveProfileField(guildID, userID, field, value string) error {
+	if !profileFieldPattern.MatchString(field) {
+		return fmt.Errorf("недопустимое имя поля профиля %q", field)
+	}
+	now := time.Now().Unix()
+	_, err := db.Exec(`
+		INSERT INTO member_profiles (guild_id, user_id, fields_json, updated_at)
+		VALUES (?, ?, json_object(?, ?), ?)
+		ON CONFLICT(guild_id, user_id) DO UPDATE SET
+			fields_json = json_set(fields_json, '$."' || ? || '"', ?),
+			updated_at = ?`,
+		guildID, userID, field, value, now,
+		field, value, now)
+	return err
+}
+
+// Загрузка профиля участника. Для участника без профиля возвращается пустой профиль
+func loadMemberProfile(guildID, userID string) (map[string]string, error) {
+	profile := make(map[string]string)
+
+	var fieldsJSON string
+	err := db.QueryRow("SELECT fields_json FROM member_profiles WHERE guild_id = ? AND user_id = ?",
+		guildID, userID).Scan(&fieldsJSON)
+	if err == sql.ErrNoRows {
+		return profile, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(fieldsJSON), &profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Обработка команды !profile <@user|user_id>
+func (sc *ServerConfig) handleProfileCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	userID := call.Args[0]
+	profile, err := loadMemberProfile(sc.GuildID, userID)
+	if err != nil {
+		logger.Error("Ошибка загрузки профиля: " + err.Error())
+		reply(s, m, "Ошибка загрузки профиля: "+err.Error())
+		return
+	}
+
+	if len(profile) == 0 {
+		reply(s, m, fmt.Sprintf("У пользователя <@%s> нет сохранённых данных профиля", userID))
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("**Профиль <@%s>:**\n%s", userID, formatProfile(profile)))
+}
+
+// Текстовое представление профиля, поля по алфавиту
+func formatProfile(profile map[string]string) string {
+	fields := make([]string, 0, len(profile))
+	for field := range profile {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	lines := make([]string, 0, len(fields))
+	for _, field := range fields {
+		lines = append(lines, fmt.Sprintf("%s: ` %s `", field, profile[field]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Значения по умолчанию для очереди регистрации
+const (
+	defaultMaxConcurrentRegistrations = 5
+	defaultRaidWindowSeconds          = 10
+	defaultRaidPauseMinutes           = 10
+)
+
+// Участник, ожидающий начала регистрации
+type queuedMember struct {
+	member     *discordgo.Member
+	form       string
+	reviewerID string // администратор, запустивший регистрацию
+	auto       bool   // регистрация запущена входом на сервер, а не администратором
+}
+
+// Очередь регистрации гильдии
+type registrationQueue struct {
+	items      []queuedMember
+	starting   map[string]bool // участники, чья регистрация запускается прямо сейчас
+	joins      []time.Time     // время последних входов для обнаружения наплыва
+	raidActive bool
+	raidUntil  time.Time
+}
+
+var (
+	registrationQueues = make(map[string]*registrationQueue) // guild_id -> очередь
+	queueMu            sync.Mutex
+)
+
+// Получение очереди гильдии. Вызывается под queueMu
+func getRegistrationQueue(guildID string) *registrationQueue {
+	q, exists := registrationQueues[guildID]
+	if !exists {
+		q = &registrationQueue{starting: make(map[string]bool)}
+		registrationQueues[guildID] = q
+	}
+	return q
+}
+
+// Максимальное число одновременных регистраций
+func (sc *ServerConfig) maxConcurrentRegistrations() int {
+	if sc.MaxConcurrentRegistrations > 0 {
+		return sc.MaxConcurrentRegistrations
+	}
+	return defaultMaxConcurrentRegistrations
+}
+
+// Окно, в котором считаются входы для обнаружения наплыва
+func (sc *ServerConfig) raidWindow() time.Duration {
+	if sc.RaidWindowSeconds > 0 {
+		return time.Duration(sc.RaidWindowSeconds) * time.Second
+	}
+	return defaultRaidWindowSeconds * time.Second
+}
+
+// Длительность паузы авторегистрации после наплыва
+func (sc *ServerConfig) raidPause() time.Duration {
+	if sc.RaidPauseMinutes > 0 {
+		return time.Duration(sc.RaidPauseMinutes) * time.Minute
+	}
+	return defaultRaidPauseMinutes * time.Minute
+}
+
+// Обработка входа участника: учёт наплыва и постановка в очередь
+func (sc *ServerConfig) QueueGuildMember(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+	sc.trackJoin(s)
+
+	// В режиме панели участник сам начинает регистрацию кнопкой,
+	// роль регистрации открывает ему канал с панелью
+	if sc.registrationMode() == RegistrationModePanel {
+		roleID := findRoleID(s, sc.GuildID, sc.RegistrationRole)
+		if roleID == "" {
+			logger.Warn("Роль 'Регистрация' не найдена!")
+			return
+		}
+		if err := s.GuildMemberRoleAdd(sc.GuildID, m.User.ID, roleID); err != nil {
+			logger.Error("Ошибка выдачи роли: " + err.Error())
+		}
+		return
+	}
+
+	form := joinForm(sc.GuildID)
+	if form == nil {
+		logger.Warn("Форма регистрации при входе не найдена для гильдии " + sc.GuildID)
+		return
+	}
+	sc.enqueueRegistration(s, queuedMember{member: m.Member, form: form.FormName(), auto: true})
+}
+
+// Учёт входа участника и обнаружение наплыва
+func (sc *ServerConfig) trackJoin(s *discordgo.Session) {
+	if sc.RaidJoinLimit <= 0 {
+		return
+	}
+
+	window := sc.raidWindow()
+	pause := sc.raidPause()
+	now := time.Now()
+
+	queueMu.Lock()
+	q := getRegistrationQueue(sc.GuildID)
+	recent := q.joins[:0]
+	for _, joinedAt := range q.joins {
+		if now.Sub(joinedAt) < window {
+			recent = append(recent, joinedAt)
+		}
+	}
+	q.joins = append(recent, now)
+
+	joins := len(q.joins)
+	if joins <= sc.RaidJoinLimit {
+		queueMu.Unlock()
+		return
+	}
+
+	started := !q.raidActive
+	q.raidActive = true
+	q.raidUntil = now.Add(pause)
+	queueMu.Unlock()
+
+	time.AfterFunc(pause, func() { sc.endRaid(s) })
+
+	if started {
+		logger.Info(fmt.Sprintf("Обнаружен наплыв участников на сервере %s: %d входов", sc.GuildID, joins))
+		sc.notifyAdmins(s, fmt.Sprintf(
+			"**Обнаружен наплыв участников:** %d входов за %s.\nАвтоматическая регистрация приостановлена, новые участники ожидают в очереди.",
+			joins, window))
+	}
+}
+
+// Завершение паузы после наплыва, если за время паузы новых всплесков не было
+func (sc *ServerConfig) endRaid(s *discordgo.Session) {
+	queueMu.Lock()
+	q := getRegistrationQueue(sc.GuildID)
+	if !q.raidActive || time.Now().Before(q.raidUntil) {
+		queueMu.Unlock()
+		return
+	}
+	q.raidActive = false
+	waiting := len(q.items)
+	queueMu.Unlock()
+
+	logger.Info("Наплыв участников на сервере " + sc.GuildID + " завершён")
+	sc.notifyAdmins(s, fmt.Sprintf(
+		"Наплыв участников завершён, автоматическая регистрация возобновлена. В очереди: %d", waiting))
+	sc.dispatchQueue(s)
+}
+
+// Постановка участника в очередь регистрации. Возвращает место в очереди (0, если
+// регистрация началась сразу) и false, если участник уже в очереди или регистрируется
+func (sc *ServerConfig) enqueueRegistration(s *discordgo.Session, request queuedMember) (int, bool) {
+	member := request.member
+
+	queueMu.Lock()
+	q := getRegistrationQueue(sc.GuildID)
+	// Участник, чья регистрация запускается или уже идёт, получил бы второй канал
+	mu.Lock()
+	_, inProgress := registeringUsers[sessionKey(sc.GuildID, member.User.ID)]
+	mu.Unlock()
+	if inProgress || q.starting[member.User.ID] {
+		queueMu.Unlock()
+		return 0, false
+	}
+	for _, item := range q.items {
+		if item.member.User.ID == member.User.ID {
+			queueMu.Unlock()
+			return 0, false
+		}
+	}
+	q.items = append(q.items, request)
+	queueMu.Unlock()
+
+	sc.dispatchQueue(s)
+
+	// Если регистрация не началась сразу, сообщаем участнику о его месте в очереди
+	queueMu.Lock()
+	position := 0
+	for i, item := range q.items {
+		if item.member.User.ID == member.User.ID {
+			position = i + 1
+			break
+		}
+	}
+	queueMu.Unlock()
+
+	if position > 0 {
+		notifyQueued(s, member.User.ID, position)
+	}
+	return position, true
+}
+
+// Удаление участника из очереди. Возвращает true, если участник был в очереди
+func (sc *ServerConfig) removeFromQueue(userID string) bool {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	q := getRegistrationQueue(sc.GuildID)
+	for i, item := range q.items {
+		if item.member.User.ID == userID {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Очистка очереди гильдии. Возвращает количество удалённых участников
+func (sc *ServerConfig) clearQueue() int {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	q := getRegistrationQueue(sc.GuildID)
+	count := len(q.items)
+	q.items = nil
+	return count
+}
+
+// Запуск регистраций из очереди в пределах лимита одновременных сессий
+func (sc *ServerConfig) dispatchQueue(s *discordgo.Session) {
+	queueMu.Lock()
+	q := getRegistrationQueue(sc.GuildID)
+	active := countGuildSessions(sc.GuildID) + len(q.starting)
+	limit := sc.maxConcurrentRegistrations()
+
+	var ready []queuedMember
+	waiting := q.items[:0]
+	for _, item := range q.items {
+		// Во время наплыва ждут только участники, вошедшие сами
+		if active >= limit || (q.raidActive && item.auto) {
+			waiting = append(waiting, item)
+			continue
+		}
+		ready = append(ready, item)
+		q.starting[item.member.User.ID] = true
+		active++
+	}
+	q.items = waiting
+	queueMu.Unlock()
+
+	for _, item := range ready {
+		go func(item queuedMember) {
+			sc.StartRegistration(s, &discordgo.Member{
+				GuildID: sc.GuildID,
+				User:    item.member.User,
+			}, item.form, item.reviewerID)
+
+			queueMu.Lock()
+			delete(q.starting, item.member.User.ID)
+			queueMu.Unlock()
+
+			// Если регистрация не началась, место освободилось для следующего участника
+			sc.dispatchQueue(s)
+		}(item)
+	}
+}
+
+// Количество участников в очереди гильдии
+func queueLength(guildID string) int {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	return len(getRegistrationQueue(guildID).items)
+}
+
+// Количество активных регистрационных сессий гильдии
+func countGuildSessions(guildID string) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	count := 0
+	for _, session := range registeringUsers {
+		if session.GuildID == guildID {
+			count++
+		}
+	}
+	return count
+}
+
+// ID участников в очереди гильдии в порядке очереди
+func queuedUserIDs(guildID string) []string {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	userIDs := []string{}
+	for _, item := range getRegistrationQueue(guildID).items {
+		userIDs = append(userIDs, item.member.User.ID)
+	}
+	return userIDs
+}
+
+// Копии активных регистрационных сессий гильдии в порядке начала
+func guildSessions(guildID string) []UserSession {
+	mu.Lock()
+	sessions := []UserSession{}
+	for _, session := range registeringUsers {
+		if session.GuildID != guildID {
+			continue
+		}
+
+		// Копируем ответы, чтобы их можно было читать без блокировки
+		snapshot := *session
+		snapshot.Answers = make(map[string]UserAnswer, len(session.Answers))
+		for questionID, answer := range session.Answers {
+			snapshot.Answers[questionID] = answer
+		}
+		snapshot.Data = make(map[string]interface{}, len(session.Data))
+		for field, value := range session.Data {
+			snapshot.Data[field] = value
+		}
+		sessions = append(sessions, snapshot)
+	}
+	mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt < sessions[j].StartedAt })
+	return sessions
+}
+
+// Уведомление участника о месте в очереди
+func notifyQueued(s *discordgo.Session, userID string, position int) {
+	channel, err := s.UserChannelCreate(userID)
+	if err != nil {
+		logger.Error("Ошибка создания личного канала: " + err.Error())
+		return
+	}
+
+	s.ChannelMessageSend(channel.ID, fmt.Sprintf(
+		"Сейчас регистрацию проходит много участников, вы в очереди (позиция: %d). "+
+			"Приватный канал для регистрации появится автоматически, когда подойдёт ваша очередь.",
+		position))
+}
+
+// Сообщение администраторам в канал команд
+func (sc *ServerConfig) notifyAdmins(s *discordgo.Session, message string) {
+	if sc.CommandChannelID == "" {
+		return
+	}
+	s.ChannelMessageSend(sc.CommandChannelID, message)
+}
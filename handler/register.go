@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -11,71 +10,159 @@ import (
 
 // Обработчик нового участника
 func (sc *ServerConfig) NewGuildMember(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+	form := joinForm(sc.GuildID)
+	if form == nil {
+		logger.Warn("Форма регистрации при входе не найдена для гильдии " + sc.GuildID)
+		return
+	}
+	sc.StartRegistration(s, m.Member, form.FormName(), "")
+}
+
+// Запуск регистрации участника по указанной форме.
+// reviewerID - администратор, запустивший регистрацию, пустой для самостоятельной регистрации
+func (sc *ServerConfig) StartRegistration(s *discordgo.Session, member *discordgo.Member, formName, reviewerID string) {
+	user := member.User
+
 	// Получаем конфигурацию сервера
-	serverConfig, exists := GetServerConfig(m.GuildID)
+	serverConfig, exists := GetServerConfig(sc.GuildID)
 	if !exists {
-		logger.Warn("Конфигурация сервера не найдена для гильдии " + m.GuildID)
+		logger.Warn("Конфигурация сервера не найдена для гильдии " + sc.GuildID)
 		return
 	}
 
-	// Выдаем роль регистрации
-	roleID := findRoleID(s, m.GuildID, serverConfig.RegistrationRole)
-	if roleID == "" {
-		logger.Warn("Роль 'Регистрация' не найдена!")
+	// Получаем форму регистрации
+	regConfig, exists := GetRegistrationForm(sc.GuildID, formName)
+	if !exists {
+		logger.Warn("Форма регистрации " + formName + " не найдена для гильдии " + sc.GuildID)
 		return
 	}
 
-	err := s.GuildMemberRoleAdd(m.GuildID, m.User.ID, roleID)
-	if err != nil {
-		logger.Error("Ошибка выдачи роли: " + err.Error())
+	// Находим первый вопрос
+	firstQuestion := findFirstQuestion(regConfig)
+	if firstQuestion == nil {
+		logger.Error("Первый вопрос не найден")
 		return
 	}
 
-	// Создаем приватный канал
-	channel, err := serverConfig.createPrivateChannel(s, m.Member)
+	// Профиль участника доступен в шаблонах новой регистрации
+	profile, err := loadMemberProfile(sc.GuildID, user.ID)
 	if err != nil {
-		logger.Error("Ошибка создания канала: " + err.Error())
-		return
+		logger.Error("Ошибка загрузки профиля: " + err.Error())
+		profile = make(map[string]string)
 	}
 
-	// Получаем конфигурацию регистрации
-	regConfig, exists := GetRegistrationConfig(m.GuildID)
-	if !exists {
-		logger.Warn("Конфигурация регистрации не найдена для гильдии " + m.GuildID)
+	// Проверяем, проходил ли участник эту форму раньше
+	previous, err := loadMemberRegistration(sc.GuildID, user.ID)
+	if err != nil {
+		logger.Error("Ошибка загрузки прошлой регистрации: " + err.Error())
+	}
+	if previous != nil && !previous.matchesForm(regConfig) {
+		previous = nil
+	}
+	if previous != nil && serverConfig.ReturningPolicy == ReturningAutoRestore {
+		serverConfig.restoreMember(s, user.ID, previous)
 		return
 	}
+	offerRestore := previous != nil && serverConfig.ReturningPolicy == ReturningConfirm
 
-	// Находим первый вопрос
-	var firstQuestion *Question
-	minOrder := int(^uint(0) >> 1) // max int
-	for i := range regConfig.Questions {
-		if regConfig.Questions[i].Order < minOrder {
-			minOrder = regConfig.Questions[i].Order
-			firstQuestion = &regConfig.Questions[i]
+	// Выдаем роль регистрации новым участникам
+	if regConfig.FormTrigger() == TriggerJoin {
+		roleID := findRoleID(s, sc.GuildID, serverConfig.RegistrationRole)
+		if roleID == "" {
+			logger.Warn("Роль 'Регистрация' не найдена!")
+			return
+		}
+
+		err = s.GuildMemberRoleAdd(sc.GuildID, user.ID, roleID)
+		if err != nil {
+			logger.Error("Ошибка выдачи роли: " + err.Error())
+			registrationsFailed.inc(sc.GuildID, "error")
+			return
 		}
 	}
 
-	if firstQuestion == nil {
-		logger.Error("Первый вопрос не найден")
+	// Создаем приватный канал
+	channel, err := serverConfig.createPrivateChannel(s, member)
+	if err != nil {
+		logger.Error("Ошибка создания канала: " + err.Error())
+		registrationsFailed.inc(sc.GuildID, "error")
 		return
 	}
 
 	// Инициализация состояния
 	mu.Lock()
 	session := &UserSession{
-		UserID:     m.User.ID,
+		GuildID:    sc.GuildID,
+		UserID:     user.ID,
 		ChannelID:  channel.ID,
+		FormName:   regConfig.FormName(),
+		ReviewerID: reviewerID,
 		CurrentQID: firstQuestion.ID,
 		Answers:    make(map[string]UserAnswer),
 		Data:       make(map[string]interface{}),
+		Profile:    profile,
 		StartedAt:  time.Now().Unix(),
 	}
-	registeringUsers[m.User.ID] = session
+	if offerRestore {
+		session.CurrentQID = restoreQuestionID
+	}
+	registeringUsers[sessionKey(sc.GuildID, user.ID)] = session
 	mu.Unlock()
+	registrationsStarted.inc(sc.GuildID)
 
-	logger.Info("Пользователь ID:" + m.User.ID + "(" + m.User.Username + ") начал регистрацию")
+	logger.Info("Пользователь ID:" + user.ID + "(" + user.Username + ") начал регистрацию по форме " + session.FormName)
+	if offerRestore {
+		serverConfig.sendRestoreOffer(s, channel.ID, previous, regConfig)
+		return
+	}
 	// Запускаем первый вопрос
-	sc.sendNextQuestion(s, session, channel.ID, m.User.ID, regConfig)
+	sc.sendNextQuestion(s, session, channel.ID, user.ID, regConfig)
+}
+
+// Поиск первого вопроса по порядку
+func findFirstQuestion(regConfig *RegistrationConfig) *Question {
+	var firstQuestion *Question
+	minOrder := int(^uint(0) >> 1) // max int
+	for i := range regConfig.Questions {
+		if regConfig.Questions[i].Order < minOrder {
+			minOrder = regConfig.Questions[i].Order
+			firstQuestion = &regConfig.Questions[i]
+		}
+	}
+	return firstQuestion
+}
+
+// Обработчик выхода участника с сервера
+func (sc *ServerConfig) GuildMemberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+	userID := m.User.ID
+
+	// Участник мог так и не дождаться своей очереди
+	if sc.removeFromQueue(userID) {
+		logger.Info("Пользователь ID:" + userID + " покинул сервер, находясь в очереди регистрации")
+	}
+
+	// Отменяем таймеры пользователя: канал завершённой регистрации закрываем сразу
+	for _, task := range cancelUserTasks(sc.GuildID, userID, taskCloseChannel) {
+		sc.closeRegistrationChannel(s, task.ChannelID, userID)
+	}
+
+	mu.Lock()
+	session, exists := registeringUsers[sessionKey(sc.GuildID, userID)]
+	delete(registeringUsers, sessionKey(sc.GuildID, userID))
+	mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	sc.closeRegistrationChannel(s, session.ChannelID, userID)
+
+	if err := recordRegistration(session, OutcomeAbandoned); err != nil {
+		logger.Error("Ошибка записи истории регистрации: " + err.Error())
+	}
+
+	logger.Info("Пользователь ID:" + userID + "(" + m.User.Username + ") покинул сервер во время регистрации")
+	sc.dispatchQueue(s)
 }
 
 // Отправка следующего вопроса
@@ -94,34 +181,42 @@ func (sc *ServerConfig) sendNextQuestion(s *discordgo.Session, session *UserSess
 		return
 	}
 
-	// Форматируем вопрос
-	message := currentQuestion.Text
-	if currentQuestion.Type == "single_choice" || currentQuestion.Type == "multiple_choice" {
-		message += "\n\n**Варианты ответа:**"
-		for _, option := range currentQuestion.Options {
-			message += fmt.Sprintf("\n`%s` - %s", option.ID, option.Text)
-		}
+	// Отправляем вопрос с оформлением формы и прогрессом
+	_, err := s.ChannelMessageSendEmbed(channelID, regConfig.questionEmbed(currentQuestion, session))
+	if err != nil {
+		logger.Error("Ошибка отправки вопроса: " + err.Error())
 	}
-
-	s.ChannelMessageSend(channelID, message)
 }
 
 // Создание приватного канала
 func (sc *ServerConfig) createPrivateChannel(s *discordgo.Session, member *discordgo.Member) (*discordgo.Channel, error) {
-	channelName := "регистрация-" + strings.ToLower(member.User.Username)
+	channels, err := s.GuildChannels(sc.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Когда категория заполнена, переходим к следующей
+	parentID, err := sc.pickRegistrationCategory(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	channelName := uniqueChannelName(sc.registrationChannelName(member.User), channels)
+
+	overwrites := []*discordgo.PermissionOverwrite{
+		sc.applicantOverwrite(member.User.ID),
+		{ID: s.State.User.ID, Type: discordgo.PermissionOverwriteTypeMember,
+			Allow: discordgo.PermissionAll},
+		{ID: sc.GuildID, Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: discordgo.PermissionViewChannel},
+	}
+	overwrites = append(overwrites, sc.staffOverwrites()...)
 
 	channelData := discordgo.GuildChannelCreateData{
-		Name:     channelName,
-		Type:     discordgo.ChannelTypeGuildText,
-		ParentID: sc.CategoryID,
-		PermissionOverwrites: []*discordgo.PermissionOverwrite{
-			{ID: member.User.ID, Type: discordgo.PermissionOverwriteTypeMember,
-				Allow: discordgo.PermissionViewChannel | discordgo.PermissionSendMessages},
-			{ID: s.State.User.ID, Type: discordgo.PermissionOverwriteTypeMember,
-				Allow: discordgo.PermissionAll},
-			{ID: sc.GuildID, Type: discordgo.PermissionOverwriteTypeRole,
-				Deny: discordgo.PermissionViewChannel},
-		},
+		Name:                 channelName,
+		Type:                 discordgo.ChannelTypeGuildText,
+		ParentID:             parentID,
+		PermissionOverwrites: overwrites,
 	}
 
 	return s.GuildChannelCreateComplex(sc.GuildID, channelData)
@@ -154,26 +249,32 @@ func (sc *ServerConfig) MessageCreate(s *discordgo.Session, m *discordgo.Message
 				s.ChannelMessageSend(m.ChannelID, "Команда !init доступна только в канале для команд")
 				return
 			}
-			handleInitCommand(s, m, guildID)
+			auditCommand(s, m, guildID, func() { dispatchCommand(s, m, guildID) })
 		}
 		return
 	}
 
 	// Обработка команд администратора
 	if sc.CommandChannelID != "" && m.ChannelID == sc.CommandChannelID && strings.HasPrefix(m.Content, "!") {
-		sc.handleAdminCommand(s, m)
+		auditCommand(s, m, sc.GuildID, func() { dispatchCommand(s, m, sc.GuildID) })
+		return
+	}
+
+	// Самостоятельный запуск регистрации участником
+	if fields := strings.Fields(m.Content); len(fields) > 0 && strings.ToLower(fields[0]) == "!register" {
+		sc.handleSelfRegistration(s, m)
 		return
 	}
 
 	// Обработка сообщений в процессе регистрации
 	mu.Lock()
-	session, ok := registeringUsers[m.Author.ID]
+	session, ok := registeringUsers[sessionKey(sc.GuildID, m.Author.ID)]
 	mu.Unlock()
 
 	if ok && m.ChannelID == session.ChannelID {
-		regConfig, exists := GetRegistrationConfig(sc.GuildID)
+		regConfig, exists := GetRegistrationForm(sc.GuildID, session.FormName)
 		if !exists {
-			logger.Error("Конфигурация регистрации не найдена")
+			logger.Error("Форма регистрации не найдена: " + session.FormName)
 			return
 		}
 		sc.processRegistrationAnswer(s, m, session, regConfig)
@@ -182,6 +283,12 @@ func (sc *ServerConfig) MessageCreate(s *discordgo.Session, m *discordgo.Message
 
 // Обработка ответа на вопрос регистрации
 func (sc *ServerConfig) processRegistrationAnswer(s *discordgo.Session, m *discordgo.MessageCreate, session *UserSession, regConfig *RegistrationConfig) {
+	// Вернувшийся участник ещё не решил, восстанавливать ли прошлую регистрацию
+	if session.CurrentQID == restoreQuestionID {
+		sc.processRestoreAnswer(s, m, session, regConfig)
+		return
+	}
+
 	answer := strings.TrimSpace(m.Content)
 
 	// Находим текущий вопрос
@@ -208,6 +315,7 @@ func (sc *ServerConfig) processRegistrationAnswer(s *discordgo.Session, m *disco
 	userAnswer := UserAnswer{
 		QuestionID: currentQuestion.ID,
 		Value:      answer,
+		AnsweredAt: time.Now().Unix(),
 	}
 
 	// Для choice типов находим выбранный вариант
@@ -264,14 +372,29 @@ func (sc *ServerConfig) completeRegistration(s *discordgo.Session, session *User
 	s.ChannelMessageSend(channelID, regConfig.Completion.Message)
 	logger.Info("Пользователь ID:" + userID + " завершил регистрацию!")
 
-	// Удаление канала
-	go func() {
-		time.Sleep(30 * time.Second)
-		mu.Lock()
-		delete(registeringUsers, userID)
-		mu.Unlock()
-		_, _ = s.ChannelDelete(channelID)
-	}()
+	// Сообщаем серверу о новом участнике
+	sc.sendAnnouncements(s, session, regConfig)
+
+	// Запоминаем регистрацию, чтобы узнать участника при повторном входе.
+	// Запись одна на участника, поэтому её обновляют только формы, запускаемые при входе:
+	// иначе дополнительная форма заменила бы регистрацию, по которой восстанавливаются роли
+	if err := recordRegistration(session, OutcomeCompleted); err != nil {
+		logger.Error("Ошибка записи истории регистрации: " + err.Error())
+	}
+	if regConfig.FormTrigger() == TriggerJoin {
+		if err := sc.saveMemberRegistration(s, session); err != nil {
+			logger.Error("Ошибка сохранения регистрации участника: " + err.Error())
+		}
+	}
+
+	// Сессия завершена, дальнейшие сообщения в канале не обрабатываются
+	mu.Lock()
+	delete(registeringUsers, sessionKey(sc.GuildID, userID))
+	mu.Unlock()
+	sc.dispatchQueue(s)
+
+	// Удаление или архивация канала по политике сервера
+	sc.scheduleChannelClose(s, userID, channelID)
 }
 
 // Валидация ответа
@@ -329,21 +452,34 @@ func (sc *ServerConfig) executeActions(s *discordgo.Session, userID string, acti
 			roleID := sc.resolveTemplate(action.RoleID, userAnswer, session)
 			if roleID != "" {
 				actualRoleID := findRoleID(s, sc.GuildID, roleID)
-				if actualRoleID != "" {
-					s.GuildMemberRoleAdd(sc.GuildID, userID, actualRoleID)
+				if actualRoleID == "" {
+					logger.Error("Роль " + roleID + " не найдена")
+					actionFailures.inc(action.Type)
+				} else if err := s.GuildMemberRoleAdd(sc.GuildID, userID, actualRoleID); err != nil {
+					logger.Error("Ошибка выдачи роли: " + err.Error())
+					actionFailures.inc(action.Type)
 				}
 			}
 		case "save_answer":
 			value := sc.resolveTemplate(action.Value, userAnswer, session)
-			if action.Storage == "permanent" {
-				// Сохраняем в session.Data для постоянного хранения
-				session.Data[action.Field] = value
+			session.Data[action.Field] = value
+			if action.Storage == StoragePermanent {
+				// Постоянные поля переживают сессию и доступны в следующих регистрациях
+				if session.Profile == nil {
+					session.Profile = make(map[string]string)
+				}
+				session.Profile[action.Field] = value
+				if err := saveProfileField(sc.GuildID, userID, action.Field, value); err != nil {
+					logger.Error("Ошибка сохранения профиля: " + err.Error())
+					actionFailures.inc(action.Type)
+				}
 			}
 		case "change_nickname":
 			nickname := sc.resolveTemplate(action.Format, userAnswer, session)
 			err := s.GuildMemberNickname(sc.GuildID, userID, nickname)
 			if err != nil {
 				logger.Error(err.Error())
+				actionFailures.inc(action.Type)
 			}
 		}
 	}
@@ -357,8 +493,12 @@ func (sc *ServerConfig) executeCompletionAction(s *discordgo.Session, userID str
 		roleID := sc.resolveTemplate(action.RoleID, nil, session)
 		if roleID != "" {
 			actualRoleID := findRoleID(s, sc.GuildID, roleID)
-			if actualRoleID != "" {
-				s.GuildMemberRoleAdd(sc.GuildID, userID, actualRoleID)
+			if actualRoleID == "" {
+				logger.Error("Роль " + roleID + " не найдена")
+				actionFailures.inc(action.Type)
+			} else if err := s.GuildMemberRoleAdd(sc.GuildID, userID, actualRoleID); err != nil {
+				logger.Error("Ошибка выдачи роли: " + err.Error())
+				actionFailures.inc(action.Type)
 			}
 		}
 	}
@@ -391,6 +531,11 @@ func (sc *ServerConfig) resolveTemplate(template string, userAnswer *UserAnswer,
 		}
 	}
 
+	// Оставшиеся поля берём из профиля участника
+	for key, value := range session.Profile {
+		result = strings.ReplaceAll(result, "{"+key+"}", value)
+	}
+
 	return result
 }
 
@@ -430,7 +575,8 @@ func (sc *ServerConfig) checkCondition(check ConditionCheck, session *UserSessio
 	case "not_equals":
 		return value != check.Value
 	case "contains":
-		return strings.Contains(value, check.Value.(string))
+		substring, ok := check.Value.(string)
+		return ok && strings.Contains(value, substring)
 	default:
 		return false
 	}
@@ -0,0 +1,449 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Типы аргументов команд. Определяют разбор значения и параметр слэш-команды
+const (
+	argString   = "string"
+	argInteger  = "integer"
+	argUser     = "user"
+	argRole     = "role"
+	argChannel  = "channel"
+	argCategory = "category"
+	argForm     = "form" // имя формы регистрации, с автодополнением
+)
+
+// Максимальная длина сообщения Discord
+const maxMessageLength = 2000
+
+// Позиционный аргумент команды
+type commandArg struct {
+	Name        string
+	Description string
+	Kind        string // по умолчанию argString
+	Required    bool
+	Choices     []string
+	Rest        bool // забирает все оставшиеся слова
+}
+
+// Флаг команды вида --name value
+type commandFlag struct {
+	Name        string
+	Value       string // название значения в справке, пустое - флаг без значения
+	Description string
+	Kind        string
+	Choices     []string
+}
+
+// Описание команды
+type commandSpec struct {
+	Name        string // имя после "!", регистр не учитывается
+	Aliases     []string
+	Description string
+	Details     string // дополнительный текст справки
+	Args        []commandArg
+	Flags       []commandFlag
+	Attachment  string // описание обязательного вложения
+	Subcommands []*commandSpec
+
+	Group      string // группа прав (init, registration, roles, stats)
+	AdminOnly  bool   // только администраторам, права не выдаются через !perms
+	Setup      bool   // доступна на сервере без конфигурации
+	Slash      string // имя слэш-команды ("roles clear"), пустое - только префиксная команда
+	PrefixOnly bool   // подкоманда не публикуется как слэш-команда
+	Audited    bool   // вызовы записываются в журнал аудита
+
+	Run func(sc *ServerConfig, s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall)
+}
+
+// Разобранный вызов команды
+type commandCall struct {
+	Spec  *commandSpec
+	Path  []string          // команда и подкоманда, например [init role]
+	Args  []string          // позиционные аргументы
+	Flags map[string]string // значения флагов, у флагов без значения - "true"
+}
+
+// Зарегистрированные команды в порядке вывода в справке
+var commandRegistry []*commandSpec
+
+// Значение флага
+func (c *commandCall) Flag(name string) string {
+	return c.Flags[name]
+}
+
+// Указан ли флаг
+func (c *commandCall) HasFlag(name string) bool {
+	_, exists := c.Flags[name]
+	return exists
+}
+
+// Текст префиксной команды, соответствующий вызову
+func (c *commandCall) String() string {
+	parts := []string{"!" + strings.Join(c.Path, " ")}
+	parts = append(parts, c.Args...)
+	for _, flag := range c.Spec.Flags {
+		value, exists := c.Flags[flag.Name]
+		if !exists {
+			continue
+		}
+		parts = append(parts, "--"+flag.Name)
+		if flag.Value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Поиск команды по имени или псевдониму
+func findCommand(name string) *commandSpec {
+	name = normalizeCommandName(name)
+	for _, spec := range commandRegistry {
+		if spec.matches(name) {
+			return spec
+		}
+	}
+	return nil
+}
+
+// Совпадает ли имя с командой или её псевдонимом
+func (spec *commandSpec) matches(name string) bool {
+	if strings.EqualFold(spec.Name, name) {
+		return true
+	}
+	for _, alias := range spec.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Поиск подкоманды
+func (spec *commandSpec) findSubcommand(name string) *commandSpec {
+	for _, sub := range spec.Subcommands {
+		if sub.matches(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Ключ прав команды: имя в нижнем регистре
+func (spec *commandSpec) key() string {
+	return strings.ToLower(spec.Name)
+}
+
+// Разбор текста команды по описанию
+func parseCommand(content string) (*commandCall, error) {
+	tokens := strings.Fields(content)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("пустая команда")
+	}
+
+	spec := findCommand(tokens[0])
+	if spec == nil {
+		return nil, fmt.Errorf("Неизвестная команда. Используй `!help` для списка команд")
+	}
+	root := spec
+	path := []string{spec.Name}
+	tokens = tokens[1:]
+
+	// Команда с подкомандами может иметь действие по умолчанию без аргументов
+	if len(spec.Subcommands) > 0 && (len(tokens) > 0 || spec.Run == nil) {
+		if len(tokens) == 0 {
+			return &commandCall{Spec: root, Path: path}, errCommandUsage
+		}
+		sub := spec.findSubcommand(tokens[0])
+		if sub == nil {
+			return &commandCall{Spec: root, Path: path}, fmt.Errorf("Неизвестная подкоманда `%s`", tokens[0])
+		}
+		spec = sub
+		path = append(path, sub.Name)
+		tokens = tokens[1:]
+	}
+
+	call := &commandCall{Spec: spec, Path: path, Flags: make(map[string]string)}
+	for i := 0; i < len(tokens); i++ {
+		if !strings.HasPrefix(tokens[i], "--") {
+			call.Args = append(call.Args, tokens[i])
+			continue
+		}
+
+		flag := spec.findFlag(strings.TrimPrefix(tokens[i], "--"))
+		if flag == nil {
+			return call, fmt.Errorf("Неизвестный флаг `%s`", tokens[i])
+		}
+		value := "true"
+		if flag.Value != "" {
+			if i+1 >= len(tokens) {
+				return call, fmt.Errorf("Не указано значение флага `--%s`", flag.Name)
+			}
+			value = tokens[i+1]
+			i++
+		}
+		call.Flags[flag.Name] = value
+	}
+
+	// Аргумент Rest забирает все оставшиеся слова
+	for index, arg := range spec.Args {
+		if arg.Rest && len(call.Args) > index {
+			call.Args = append(call.Args[:index], strings.Join(call.Args[index:], " "))
+			break
+		}
+	}
+
+	if err := call.normalize(); err != nil {
+		return call, err
+	}
+	return call, nil
+}
+
+// Ошибка, при которой достаточно показать использование команды
+var errCommandUsage = errors.New("неверное использование команды")
+
+// Поиск флага команды
+func (spec *commandSpec) findFlag(name string) *commandFlag {
+	for i := range spec.Flags {
+		if strings.EqualFold(spec.Flags[i].Name, name) {
+			return &spec.Flags[i]
+		}
+	}
+	return nil
+}
+
+// Проверка обязательных аргументов и приведение значений к их типам
+func (c *commandCall) normalize() error {
+	required := 0
+	for _, arg := range c.Spec.Args {
+		if arg.Required {
+			required++
+		}
+	}
+	if len(c.Args) < required {
+		return errCommandUsage
+	}
+
+	for i := range c.Args {
+		if i >= len(c.Spec.Args) {
+			break
+		}
+		value, err := normalizeArgValue(c.Spec.Args[i].Name, c.Spec.Args[i].Kind, c.Spec.Args[i].Choices, c.Args[i])
+		if err != nil {
+			return err
+		}
+		c.Args[i] = value
+	}
+	for _, flag := range c.Spec.Flags {
+		if value, exists := c.Flags[flag.Name]; exists && flag.Value != "" {
+			normalized, err := normalizeArgValue("--"+flag.Name, flag.Kind, flag.Choices, value)
+			if err != nil {
+				return err
+			}
+			c.Flags[flag.Name] = normalized
+		}
+	}
+	return nil
+}
+
+// Приведение значения аргумента: упоминания заменяются на ID, числа и варианты проверяются
+func normalizeArgValue(name, kind string, choices []string, value string) (string, error) {
+	switch kind {
+	case argUser:
+		value = parseUserID(value)
+	case argRole:
+		value = parseRoleID(value)
+	case argChannel, argCategory:
+		value = parseChannelID(value)
+	case argForm:
+		value = normalizeFormName(value)
+	case argInteger:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("Значение `%s` должно быть числом", name)
+		}
+	}
+
+	if len(choices) > 0 {
+		for _, choice := range choices {
+			if strings.EqualFold(choice, value) {
+				return choice, nil
+			}
+		}
+		return "", fmt.Errorf("Значение `%s` должно быть одним из: %s", name, strings.Join(choices, ", "))
+	}
+	return value, nil
+}
+
+// Выполнение команды: проверка прав, конфигурации сервера и запуск обработчика
+func executeCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID string, call *commandCall) {
+	command := strings.Join(call.Path, " ")
+	root := findCommand(call.Path[0])
+	// Подкоманда только для администраторов закрыта даже при правах на всю команду
+	if !commandAllowed(s, m, guildID, root) || (call.Spec.AdminOnly && !IsAdmin(s, m)) {
+		logger.Warn("Попытка пользователя использовать команды")
+		commandsExecuted.inc(command, "denied")
+		reply(s, m, "У вас недостаточно прав для выполнения этой команды")
+		return
+	}
+
+	serverConfig, exists := GetServerConfig(guildID)
+	if !exists {
+		if !root.Setup {
+			commandsExecuted.inc(command, "not_configured")
+			reply(s, m, "Сервер не настроен, начните с команды `!init`")
+			return
+		}
+		// Создаем новую конфигурацию
+		serverConfig = &ServerConfig{GuildID: guildID}
+	}
+
+	logger.Info("Запуск команды !" + command)
+	started := time.Now()
+	call.Spec.Run(serverConfig, s, m, call)
+	commandsExecuted.inc(command, "ok")
+	commandDuration.add(time.Since(started).Seconds(), command)
+}
+
+// Обработка префиксной команды
+func dispatchCommand(s *discordgo.Session, m *discordgo.MessageCreate, guildID string) {
+	call, err := parseCommand(m.Content)
+	if call == nil {
+		reply(s, m, err.Error())
+		return
+	}
+	if err != nil {
+		// Без прав не показываем даже справку по команде
+		if !commandAllowed(s, m, guildID, findCommand(call.Path[0])) {
+			reply(s, m, "У вас недостаточно прав для выполнения этой команды")
+			return
+		}
+		if errors.Is(err, errCommandUsage) {
+			replyLong(s, m, call.Spec.help(call.Path[:len(call.Path)-1]))
+			return
+		}
+		reply(s, m, err.Error()+"\nСправка: `!help "+strings.Join(call.Path, " ")+"`")
+		return
+	}
+
+	executeCommand(s, m, guildID, call)
+}
+
+// Строка использования команды, например `!init role <role> [--flag VALUE]`
+func (spec *commandSpec) usage(parents []string) string {
+	parts := []string{"!" + strings.Join(append(append([]string{}, parents...), spec.Name), " ")}
+	if len(spec.Subcommands) > 0 {
+		parts = append(parts, "<подкоманда>")
+	}
+	for _, arg := range spec.Args {
+		name := arg.Name
+		if len(arg.Choices) > 0 {
+			name = strings.Join(arg.Choices, "|")
+		}
+		if arg.Rest {
+			name += "..."
+		}
+		if arg.Required {
+			parts = append(parts, "<"+name+">")
+		} else {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+	for _, flag := range spec.Flags {
+		if flag.Value != "" {
+			parts = append(parts, "[--"+flag.Name+" "+flag.Value+"]")
+		} else {
+			parts = append(parts, "[--"+flag.Name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Подробная справка по команде
+func (spec *commandSpec) help(parents []string) string {
+	help := fmt.Sprintf("**%s**\n%s\n", spec.usage(parents), spec.Description)
+	if len(spec.Aliases) > 0 {
+		help += "Псевдонимы: !" + strings.Join(spec.Aliases, ", !") + "\n"
+	}
+	if spec.Attachment != "" {
+		help += "Вложение: " + spec.Attachment + "\n"
+	}
+
+	if len(spec.Args) > 0 {
+		help += "\nАргументы:\n"
+		for _, arg := range spec.Args {
+			help += fmt.Sprintf("`%s` - %s\n", arg.Name, arg.Description)
+		}
+	}
+	if len(spec.Flags) > 0 {
+		help += "\nФлаги:\n"
+		for _, flag := range spec.Flags {
+			help += fmt.Sprintf("`--%s` - %s\n", flag.Name, flag.Description)
+		}
+	}
+	if len(spec.Subcommands) > 0 {
+		help += "\nПодкоманды:\n"
+		for _, sub := range spec.Subcommands {
+			help += fmt.Sprintf("%s - %s\n", sub.usage(append(parents, spec.Name)), sub.Description)
+		}
+	}
+
+	if len(parents) == 0 {
+		switch {
+		case spec.AdminOnly:
+			help += "\nДоступ: только администраторы\n"
+		case spec.Group != "":
+			help += fmt.Sprintf("\nДоступ: администраторы и роли с правом на `%s` или группу `%s`\n", spec.key(), spec.Group)
+		}
+	} else if spec.AdminOnly {
+		help += "\nДоступ: только администраторы\n"
+	}
+	if spec.Details != "" {
+		help += "\n" + spec.Details
+	}
+	return help
+}
+
+// Список всех команд для !help
+func commandListHelp() string {
+	help := "**Доступные команды администратора:**\n\n"
+	for _, spec := range commandRegistry {
+		help += fmt.Sprintf("%s - %s\n", spec.usage(nil), spec.Description)
+	}
+	help += "\nПодробнее о команде: `!help <команда>`, например `!help init` или `!help init panel`"
+	return help
+}
+
+// Отправка длинного ответа несколькими сообщениями по строкам
+func replyLong(s *discordgo.Session, m *discordgo.MessageCreate, content string) {
+	for _, chunk := range splitMessage(content, maxMessageLength) {
+		reply(s, m, chunk)
+	}
+}
+
+// Разбиение текста на части не длиннее limit символов по границам строк
+func splitMessage(content string, limit int) []string {
+	chunks := []string{}
+	current := ""
+	for _, line := range strings.Split(content, "\n") {
+		if current != "" && len([]rune(current))+len([]rune(line))+1 > limit {
+			chunks = append(chunks, current)
+			current = ""
+		}
+		if current != "" {
+			current += "\n"
+		}
+		current += line
+	}
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantPath  []string
+		wantArgs  []string
+		wantFlags map[string]string
+		wantUsage bool   // ожидается errCommandUsage
+		wantErr   string // подстрока текста ошибки
+		wantNil   bool   // команда не найдена
+	}{
+		{
+			name:      "флаг со значением и упоминанием",
+			content:   "!stopRegistred --user_id <@!123>",
+			wantPath:  []string{"stopRegistred"},
+			wantFlags: map[string]string{"user_id": "123"},
+		},
+		{
+			name:      "флаг без значения",
+			content:   "!stopRegistred --all",
+			wantPath:  []string{"stopRegistred"},
+			wantFlags: map[string]string{"all": "true"},
+		},
+		{
+			name:      "имя команды и флага без учёта регистра",
+			content:   "!STOPREGISTRED --ALL",
+			wantPath:  []string{"stopRegistred"},
+			wantFlags: map[string]string{"all": "true"},
+		},
+		{
+			name:     "флаг без обязательного значения",
+			content:  "!stopRegistred --user_id",
+			wantPath: []string{"stopRegistred"},
+			wantErr:  "Не указано значение флага `--user_id`",
+		},
+		{
+			name:     "неизвестный флаг",
+			content:  "!stopRegistred --bogus",
+			wantPath: []string{"stopRegistred"},
+			wantErr:  "Неизвестный флаг `--bogus`",
+		},
+		{
+			name:      "аргумент Rest забирает оставшиеся слова",
+			content:   "!search family_name=Иван Петров --page 2",
+			wantPath:  []string{"search"},
+			wantArgs:  []string{"family_name=Иван Петров"},
+			wantFlags: map[string]string{"page": "2"},
+		},
+		{
+			name:      "нет обязательного аргумента",
+			content:   "!search",
+			wantPath:  []string{"search"},
+			wantUsage: true,
+		},
+		{
+			name:      "варианты без учёта регистра",
+			content:   "!export PROFILES --format JSON",
+			wantPath:  []string{"export"},
+			wantArgs:  []string{"profiles"},
+			wantFlags: map[string]string{"format": "json"},
+		},
+		{
+			name:     "значение не из вариантов",
+			content:  "!export users",
+			wantPath: []string{"export"},
+			wantErr:  "должно быть одним из: registrations, profiles",
+		},
+		{
+			name:     "числовой аргумент",
+			content:  "!restoreRoles abc",
+			wantPath: []string{"restoreRoles"},
+			wantErr:  "Значение `snapshot` должно быть числом",
+		},
+		{
+			name:     "подкоманда с аргументами",
+			content:  "!init channel_policy ARCHIVE 30",
+			wantPath: []string{"init", "channel_policy"},
+			wantArgs: []string{"archive", "30"},
+		},
+		{
+			name:     "упоминание канала в подкоманде",
+			content:  "!init panel <#456>",
+			wantPath: []string{"init", "panel"},
+			wantArgs: []string{"456"},
+		},
+		{
+			name:      "команда без подкоманды",
+			content:   "!import",
+			wantPath:  []string{"import"},
+			wantUsage: true,
+		},
+		{
+			name:     "неизвестная подкоманда",
+			content:  "!import bogus",
+			wantPath: []string{"import"},
+			wantErr:  "Неизвестная подкоманда `bogus`",
+		},
+		{
+			name:    "неизвестная команда",
+			content: "!bogus",
+			wantNil: true,
+			wantErr: "Неизвестная команда",
+		},
+		{
+			name:    "пустая команда",
+			content: "   ",
+			wantNil: true,
+			wantErr: "пустая команда",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call, err := parseCommand(tt.content)
+
+			if tt.wantNil {
+				if call != nil {
+					t.Fatalf("parseCommand(%q) = %+v, ожидалось nil", tt.content, call)
+				}
+			} else {
+				if call == nil {
+					t.Fatalf("parseCommand(%q) = nil, %v", tt.content, err)
+				}
+				if !reflect.DeepEqual(call.Path, tt.wantPath) {
+					t.Errorf("Path = %q, ожидалось %q", call.Path, tt.wantPath)
+				}
+			}
+
+			switch {
+			case tt.wantUsage:
+				if !errors.Is(err, errCommandUsage) {
+					t.Fatalf("ошибка = %v, ожидалась errCommandUsage", err)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ошибка = %v, ожидалась ошибка с %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+
+			if len(call.Args) != 0 || len(tt.wantArgs) != 0 {
+				if !reflect.DeepEqual(call.Args, tt.wantArgs) {
+					t.Errorf("Args = %q, ожидалось %q", call.Args, tt.wantArgs)
+				}
+			}
+			if len(call.Flags) != 0 || len(tt.wantFlags) != 0 {
+				if !reflect.DeepEqual(call.Flags, tt.wantFlags) {
+					t.Errorf("Flags = %v, ожидалось %v", call.Flags, tt.wantFlags)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeArgValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		choices []string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "упоминание пользователя", kind: argUser, value: "<@123>", want: "123"},
+		{name: "упоминание пользователя с ником", kind: argUser, value: "<@!123>", want: "123"},
+		{name: "ID пользователя", kind: argUser, value: "123", want: "123"},
+		{name: "упоминание роли", kind: argRole, value: "<@&456>", want: "456"},
+		{name: "упоминание канала", kind: argChannel, value: "<#789>", want: "789"},
+		{name: "категория", kind: argCategory, value: "<#789>", want: "789"},
+		{name: "имя формы", kind: argForm, value: " Guests ", want: "guests"},
+		{name: "число", kind: argInteger, value: "42", want: "42"},
+		{name: "не число", kind: argInteger, value: "42d", wantErr: true},
+		{name: "вариант", choices: []string{"auto", "panel"}, value: "PANEL", want: "panel"},
+		{name: "не вариант", choices: []string{"auto", "panel"}, value: "manual", wantErr: true},
+		{name: "строка", kind: argString, value: "reg-{username}", want: "reg-{username}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeArgValue("arg", tt.kind, tt.choices, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("normalizeArgValue(%q) = %q, ожидалась ошибка", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("неожиданная ошибка: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeArgValue(%q) = %q, ожидалось %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandCallNormalize(t *testing.T) {
+	spec := findCommand("export")
+	call := &commandCall{Spec: spec, Path: []string{"export"}, Flags: map[string]string{"format": "CSV"}}
+	if err := call.normalize(); !errors.Is(err, errCommandUsage) {
+		t.Fatalf("без обязательного аргумента ошибка = %v, ожидалась errCommandUsage", err)
+	}
+
+	call.Args = []string{"Registrations"}
+	if err := call.normalize(); err != nil {
+		t.Fatalf("неожиданная ошибка: %v", err)
+	}
+	if call.Args[0] != "registrations" || call.Flags["format"] != "csv" {
+		t.Errorf("Args = %q, Flags = %v", call.Args, call.Flags)
+	}
+
+	call.Flags["format"] = "xml"
+	if err := call.normalize(); err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("ошибка = %v, ожидалась ошибка флага --format", err)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		limit   int
+		want    []string
+	}{
+		{name: "пустой текст", content: "", limit: 10, want: []string{}},
+		{name: "короткий текст", content: "abc\ndef", limit: 10, want: []string{"abc\ndef"}},
+		{name: "ровно по лимиту", content: "abcd\nefgh", limit: 9, want: []string{"abcd\nefgh"}},
+		{name: "разбиение по строкам", content: "abcd\nefgh\nij", limit: 8, want: []string{"abcd", "efgh\nij"}},
+		{name: "лимит в символах, а не байтах", content: "абвг\nдеёж", limit: 9, want: []string{"абвг\nдеёж"}},
+		{name: "строка длиннее лимита не режется", content: "ab\nabcdefghij\ncd", limit: 5, want: []string{"ab", "abcdefghij", "cd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.content, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, ожидалось %q", tt.content, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		path []string
+		want []string
+	}{
+		{
+			name: "команда с флагами",
+			path: []string{"stopRegistred"},
+			want: []string{
+				"**!stopRegistred [--all] [--user_id USER_ID]**",
+				"`--user_id` - Применяется к конкретному пользователю",
+				"Доступ: администраторы и роли с правом на `stopregistred` или группу `registration`",
+				"Прерванные регистрации потребуют повторного запуска",
+			},
+		},
+		{
+			name: "команда с аргументом Rest и вариантами",
+			path: []string{"search"},
+			want: []string{"**!search <field=value...> [--page N]**"},
+		},
+		{
+			name: "команда с подкомандами",
+			path: []string{"init"},
+			want: []string{
+				"**!init <подкоманда>**",
+				"Подкоманды:",
+				"!init channel_policy <delete|archive|keep> [delay_seconds] - Что делать с каналом после регистрации",
+			},
+		},
+		{
+			name: "подкоманда",
+			path: []string{"init", "mode"},
+			want: []string{"**!init mode <auto|panel>**"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := findCommand(tt.path[0])
+			if spec == nil {
+				t.Fatalf("команда %s не найдена", tt.path[0])
+			}
+			parents := []string{}
+			for _, name := range tt.path[1:] {
+				parents = append(parents, spec.Name)
+				if spec = spec.findSubcommand(name); spec == nil {
+					t.Fatalf("подкоманда %s не найдена", name)
+				}
+			}
+
+			help := spec.help(parents)
+			for _, want := range tt.want {
+				if !strings.Contains(help, want) {
+					t.Errorf("справка не содержит %q:\n%s", want, help)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandListHelp(t *testing.T) {
+	help := commandListHelp()
+	for _, spec := range commandRegistry {
+		if !strings.Contains(help, spec.usage(nil)+" - "+spec.Description) {
+			t.Errorf("список команд не содержит !%s", spec.Name)
+		}
+	}
+	for _, chunk := range splitMessage(help, maxMessageLength) {
+		if length := len([]rune(chunk)); length > maxMessageLength {
+			t.Errorf("часть справки длиной %d больше %d", length, maxMessageLength)
+		}
+	}
+}
+
+func TestSlashCommandsOptionLimit(t *testing.T) {
+	registered := make(map[string]bool)
+	for _, command := range slashCommands() {
+		registered[command.Name] = true
+		if overflow := slashOptionsOverflow(command.Name, command.Options); overflow != "" {
+			t.Errorf("в /%s больше %d параметров", overflow, maxSlashOptions)
+		}
+	}
+
+	// slashCommands пропускает слишком большие команды, поэтому каждая должна дойти до регистрации
+	for _, spec := range commandRegistry {
+		if spec.Slash == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(spec.Slash, " ")
+		if !registered[name] {
+			t.Errorf("слэш-команда /%s для !%s не зарегистрирована", name, spec.Name)
+		}
+	}
+}
+
+func TestSlashOptionsOverflow(t *testing.T) {
+	options := func(count int) []*discordgo.ApplicationCommandOption {
+		result := make([]*discordgo.ApplicationCommandOption, count)
+		for i := range result {
+			result[i] = &discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString}
+		}
+		return result
+	}
+
+	if overflow := slashOptionsOverflow("init", options(maxSlashOptions)); overflow != "" {
+		t.Errorf("для %d параметров overflow = %q", maxSlashOptions, overflow)
+	}
+	if overflow := slashOptionsOverflow("init", options(maxSlashOptions+1)); overflow != "init" {
+		t.Errorf("для %d параметров overflow = %q, ожидалось init", maxSlashOptions+1, overflow)
+	}
+
+	nested := []*discordgo.ApplicationCommandOption{{
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Name:    "panel",
+		Options: options(maxSlashOptions + 1),
+	}}
+	if overflow := slashOptionsOverflow("init", nested); overflow != "init panel" {
+		t.Errorf("для подкоманды overflow = %q, ожидалось \"init panel\"", overflow)
+	}
+}
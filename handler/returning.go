@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Политики обработки вернувшихся участников
+const (
+	ReturningReregister  = "reregister" // пройти регистрацию заново (по умолчанию)
+	ReturningConfirm     = "confirm"    // предложить восстановить прошлые ответы и роли
+	ReturningAutoRestore = "auto"       // восстановить роли без вопросов
+)
+
+// Служебный идентификатор шага подтверждения восстановления
+const restoreQuestionID = "__restore"
+
+// Завершённая регистрация участника
+type MemberRegistration struct {
+	Session     UserSession `json:"session"`
+	Roles       []string    `json:"roles"`
+	Nickname    string      `json:"nickname"`
+	CompletedAt int64       `json:"completed_at"`
+}
+
+// Проверка корректности политики для вернувшихся участников
+func isValidReturningPolicy(policy string) bool {
+	switch policy {
+	case ReturningReregister, ReturningConfirm, ReturningAutoRestore:
+		return true
+	}
+	return false
+}
+
+// Сохранение завершённой регистрации вместе с текущими ролями и ником участника
+func (sc *ServerConfig) saveMemberRegistration(s *discordgo.Session, session *UserSession) error {
+	member, err := s.GuildMember(sc.GuildID, session.UserID)
+	if err != nil {
+		return err
+	}
+
+	registrationRoleID := findRoleID(s, sc.GuildID, sc.RegistrationRole)
+	roles := []string{}
+	for _, roleID := range member.Roles {
+		if roleID == registrationRoleID || roleID == sc.GuildID {
+			continue
+		}
+		roles = append(roles, roleID)
+	}
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	rolesJSON, err := json.Marshal(roles)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO member_registrations (guild_id, user_id, session_json, roles_json, nickname, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sc.GuildID, session.UserID, string(sessionJSON), string(rolesJSON), member.Nick, time.Now().Unix())
+	return err
+}
+
+// Загрузка завершённой регистрации участника. Возвращает nil, если участник не регистрировался
+func loadMemberRegistration(guildID, userID string) (*MemberRegistration, error) {
+	var sessionJSON, rolesJSON string
+	registration := &MemberRegistration{}
+	err := db.QueryRow(`
+		SELECT session_json, roles_json, nickname, completed_at FROM member_registrations
+		WHERE guild_id = ? AND user_id = ?`,
+		guildID, userID).Scan(&sessionJSON, &rolesJSON, &registration.Nickname, &registration.CompletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(sessionJSON), &registration.Session); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rolesJSON), &registration.Roles); err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+// Подходит ли прошлая регистрация к форме.
+// Импортированные участники считаются прошедшими форму, запускаемую при входе
+func (registration *MemberRegistration) matchesForm(form *RegistrationConfig) bool {
+	name := normalizeFormName(registration.Session.FormName)
+	if name == importFormName {
+		return form.FormTrigger() == TriggerJoin
+	}
+	return name == form.FormName()
+}
+
+// Восстановление ролей и ника вернувшегося участника
+func (sc *ServerConfig) restoreMember(s *discordgo.Session, userID string, registration *MemberRegistration) {
+	for _, roleID := range registration.Roles {
+		if findRoleID(s, sc.GuildID, roleID) == "" {
+			logger.Warn("Роль " + roleID + " больше не существует, пропускаем")
+			continue
+		}
+		if err := s.GuildMemberRoleAdd(sc.GuildID, userID, roleID); err != nil {
+			logger.Error("Ошибка восстановления роли " + roleID + ": " + err.Error())
+		}
+	}
+
+	if registration.Nickname != "" {
+		if err := s.GuildMemberNickname(sc.GuildID, userID, registration.Nickname); err != nil {
+			logger.Error("Ошибка восстановления ника: " + err.Error())
+		}
+	}
+
+	if roleID := findRoleID(s, sc.GuildID, sc.RegistrationRole); roleID != "" {
+		_ = s.GuildMemberRoleRemove(sc.GuildID, userID, roleID)
+	}
+
+	session := registration.Session
+	session.StartedAt = time.Now().Unix()
+	if err := recordRegistration(&session, OutcomeRestored); err != nil {
+		logger.Error("Ошибка записи истории регистрации: " + err.Error())
+	}
+
+	logger.Info("Пользователю ID:" + userID + " восстановлены роли прошлой регистрации")
+}
+
+// Предложение восстановить прошлую регистрацию
+func (sc *ServerConfig) sendRestoreOffer(s *discordgo.Session, channelID string, registration *MemberRegistration, regConfig *RegistrationConfig) {
+	message := fmt.Sprintf("С возвращением! Вы уже проходили регистрацию %s.\n\n**Ваши прошлые ответы:**",
+		time.Unix(registration.CompletedAt, 0).Format("02.01.2006"))
+
+	for _, question := range regConfig.Questions {
+		answer, exists := registration.Session.Answers[question.ID]
+		if !exists {
+			continue
+		}
+		message += fmt.Sprintf("\n%s — `%s`", question.Text, formatAnswer(answer))
+	}
+
+	if len(registration.Roles) > 0 {
+		message += "\n\n**Роли:**"
+		for _, roleID := range registration.Roles {
+			message += fmt.Sprintf(" <@&%s>", roleID)
+		}
+	}
+
+	message += "\n\nОтправьте `да`, чтобы восстановить их, или `нет`, чтобы пройти регистрацию заново."
+	s.ChannelMessageSend(channelID, message)
+}
+
+// Обработка ответа на предложение восстановить регистрацию
+func (sc *ServerConfig) processRestoreAnswer(s *discordgo.Session, m *discordgo.MessageCreate, session *UserSession, regConfig *RegistrationConfig) {
+	switch strings.ToLower(strings.TrimSpace(m.Content)) {
+	case "да", "yes":
+		registration, err := loadMemberRegistration(sc.GuildID, session.UserID)
+		if err != nil || registration == nil {
+			if err != nil {
+				logger.Error("Ошибка загрузки прошлой регистрации: " + err.Error())
+			}
+			s.ChannelMessageSend(m.ChannelID, "Не удалось найти прошлую регистрацию, пройдите её заново.")
+			sc.restartFromFirstQuestion(s, session, regConfig)
+			return
+		}
+
+		sc.restoreMember(s, session.UserID, registration)
+
+		mu.Lock()
+		delete(registeringUsers, sessionKey(session.GuildID, session.UserID))
+		mu.Unlock()
+		sc.dispatchQueue(s)
+
+		s.ChannelMessageSend(m.ChannelID, "Роли восстановлены. С возвращением!")
+		sc.scheduleChannelClose(s, session.UserID, session.ChannelID)
+
+	case "нет", "no":
+		sc.restartFromFirstQuestion(s, session, regConfig)
+
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Пожалуйста, ответьте `да` или `нет`.")
+	}
+}
+
+// Запуск регистрации с первого вопроса в уже созданной сессии
+func (sc *ServerConfig) restartFromFirstQuestion(s *discordgo.Session, session *UserSession, regConfig *RegistrationConfig) {
+	firstQuestion := findFirstQuestion(regConfig)
+	if firstQuestion == nil {
+		logger.Error("Первый вопрос не найден")
+		return
+	}
+
+	session.CurrentQID = firstQuestion.ID
+	sc.sendNextQuestion(s, session, session.ChannelID, session.UserID, regConfig)
+}
+
+// Текстовое представление ответа
+func formatAnswer(answer UserAnswer) string {
+	if answer.Selected != nil {
+		return answer.Selected.Text
+	}
+	return fmt.Sprint(answer.Value)
+}
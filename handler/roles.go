@@ -0,0 +1,459 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Сколько подготовленная очистка ролей ждёт подтверждения
+const clearRolesTTL = 5 * time.Minute
+
+// Сколько снимков ролей показывать в списке
+const roleSnapshotsShown = 10
+
+// Подготовленная очистка ролей, ожидающая подтверждения кодом
+type rolesClear struct {
+	AdminID   string
+	Code      string
+	CreatedAt time.Time
+}
+
+var (
+	pendingRoleClears = make(map[string]*rolesClear) // guild_id -> очистка
+	roleClearsMu      sync.Mutex
+)
+
+// План очистки ролей: какие роли снимаются и какие остаются
+type rolesClearPlan struct {
+	Members   []*discordgo.Member // участники сервера без ботов
+	Removals  map[string][]string // user_id -> снимаемые роли
+	Removed   map[string]int      // role_id -> у скольких участников будет снята
+	Preserved []string            // сохраняемые роли из настроек сервера
+	Managed   []string            // роли интеграций и ботов
+	AboveBot  []string            // роли не ниже роли бота
+}
+
+// Снимок ролей участников перед очисткой
+type roleSnapshot struct {
+	ID         int64
+	GuildID    string
+	ActorID    string
+	Roles      map[string][]string // user_id -> роли
+	CreatedAt  int64
+	RestoredAt int64
+}
+
+// Обработка команды !clsRoles [--dry-run] [--confirm CODE]
+func (sc *ServerConfig) handleClearRolesCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if code := call.Flag("confirm"); code != "" {
+		sc.confirmClearRoles(s, m, code)
+		return
+	}
+
+	plan, err := sc.planRoleClear(s)
+	if err != nil {
+		logger.Error("Ошибка подготовки очистки ролей: " + err.Error())
+		reply(s, m, "Ошибка подготовки очистки ролей: "+err.Error())
+		return
+	}
+
+	if call.HasFlag("dry-run") {
+		replyLong(s, m, "**Пробная очистка ролей (изменения не применены)**\n"+plan.report())
+		return
+	}
+	if len(plan.Removals) == 0 {
+		replyLong(s, m, "Снимать нечего\n"+plan.report())
+		return
+	}
+
+	code := fmt.Sprintf("%06d", rand.IntN(1000000))
+	roleClearsMu.Lock()
+	pendingRoleClears[sc.GuildID] = &rolesClear{AdminID: m.Author.ID, Code: code, CreatedAt: time.Now()}
+	roleClearsMu.Unlock()
+
+	replyLong(s, m, "**Очистка ролей ожидает подтверждения**\n"+plan.report()+
+		fmt.Sprintf("\nПеред очисткой роли участников будут сохранены в снимок. Для подтверждения отправьте `!clsRoles --confirm %s` в течение %d минут", code, int(clearRolesTTL.Minutes())))
+}
+
+// Проверка кода подтверждения и очистка ролей
+func (sc *ServerConfig) confirmClearRoles(s *discordgo.Session, m *discordgo.MessageCreate, code string) {
+	roleClearsMu.Lock()
+	pending, exists := pendingRoleClears[sc.GuildID]
+	if exists && time.Since(pending.CreatedAt) > clearRolesTTL {
+		delete(pendingRoleClears, sc.GuildID)
+		exists = false
+	}
+	confirmed := exists && pending.AdminID == m.Author.ID && pending.Code == strings.TrimSpace(code)
+	if confirmed {
+		delete(pendingRoleClears, sc.GuildID)
+	}
+	roleClearsMu.Unlock()
+
+	switch {
+	case !exists:
+		reply(s, m, "Нет очистки ролей, ожидающей подтверждения. Сначала отправьте `!clsRoles`")
+		return
+	case pending.AdminID != m.Author.ID:
+		reply(s, m, "Очистку ролей должен подтвердить запустивший её администратор")
+		return
+	case !confirmed:
+		reply(s, m, "Неверный код подтверждения")
+		return
+	}
+
+	// Состав ролей мог измениться с момента запроса, поэтому план строится заново
+	plan, err := sc.planRoleClear(s)
+	if err != nil {
+		logger.Error("Ошибка подготовки очистки ролей: " + err.Error())
+		reply(s, m, "Ошибка подготовки очистки ролей: "+err.Error())
+		return
+	}
+
+	snapshot := &roleSnapshot{GuildID: sc.GuildID, ActorID: m.Author.ID, Roles: make(map[string][]string), CreatedAt: time.Now().Unix()}
+	for _, member := range plan.Members {
+		snapshot.Roles[member.User.ID] = member.Roles
+	}
+	if err := saveRoleSnapshot(snapshot); err != nil {
+		logger.Error("Ошибка сохранения снимка ролей: " + err.Error())
+		reply(s, m, "Ошибка сохранения снимка ролей, очистка отменена: "+err.Error())
+		return
+	}
+
+	reply(s, m, fmt.Sprintf("Снимок ролей #%d сохранён. Начинаю удаление ролей... Это может занять время", snapshot.ID))
+
+	successCount := 0
+	failCount := 0
+	for _, member := range plan.Members {
+		removals, exists := plan.Removals[member.User.ID]
+		if !exists {
+			continue
+		}
+
+		newRoles := withoutRoles(member.Roles, removals)
+		_, err := s.GuildMemberEdit(sc.GuildID, member.User.ID, &discordgo.GuildMemberParams{
+			Roles: &newRoles,
+		})
+		if err != nil {
+			logger.Error("Ошибка удаления ролей у " + member.User.Username + ": " + err.Error())
+			failCount++
+		} else {
+			successCount++
+		}
+
+		// Задержка для предотвращения лимитов
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	reply(s, m, fmt.Sprintf(
+		"Удаление ролей завершено!\nУспешно: %d\nНе удалось: %d\nВернуть роли: `!restoreRoles %d`",
+		successCount, failCount, snapshot.ID))
+}
+
+// Построение плана очистки: сохраняются @everyone, роли из настроек,
+// роли интеграций и роли, которыми бот не может управлять
+func (sc *ServerConfig) planRoleClear(s *discordgo.Session) (*rolesClearPlan, error) {
+	roles, err := s.GuildRoles(sc.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := fetchGuildMembers(s, sc.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &rolesClearPlan{Removals: make(map[string][]string), Removed: make(map[string]int)}
+	botPosition := botTopRolePosition(s, sc.GuildID, roles)
+	preserved := make(map[string]bool)
+	for _, roleID := range sc.PreservedRoles {
+		preserved[roleID] = true
+	}
+
+	kept := make(map[string]bool)
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Position > roles[j].Position })
+	for _, role := range roles {
+		switch {
+		case role.ID == sc.GuildID:
+			kept[role.ID] = true
+		case preserved[role.ID]:
+			kept[role.ID] = true
+			plan.Preserved = append(plan.Preserved, role.ID)
+		case role.Managed:
+			kept[role.ID] = true
+			plan.Managed = append(plan.Managed, role.ID)
+		case role.Position >= botPosition:
+			kept[role.ID] = true
+			plan.AboveBot = append(plan.AboveBot, role.ID)
+		}
+	}
+
+	for _, member := range members {
+		// Пропускаем ботов
+		if member.User.Bot {
+			continue
+		}
+		plan.Members = append(plan.Members, member)
+
+		removals := []string{}
+		for _, roleID := range member.Roles {
+			if !kept[roleID] {
+				removals = append(removals, roleID)
+				plan.Removed[roleID]++
+			}
+		}
+		if len(removals) > 0 {
+			plan.Removals[member.User.ID] = removals
+		}
+	}
+	return plan, nil
+}
+
+// Позиция самой высокой роли бота на сервере
+func botTopRolePosition(s *discordgo.Session, guildID string, roles []*discordgo.Role) int {
+	botRoles := make(map[string]bool)
+	for _, roleID := range memberRoleIDs(s, guildID, s.State.User.ID) {
+		botRoles[roleID] = true
+	}
+
+	position := 0
+	for _, role := range roles {
+		if botRoles[role.ID] && role.Position > position {
+			position = role.Position
+		}
+	}
+	return position
+}
+
+// Отчёт о плане очистки ролей
+func (plan *rolesClearPlan) report() string {
+	removedRoles := make([]string, 0, len(plan.Removed))
+	for roleID := range plan.Removed {
+		removedRoles = append(removedRoles, roleID)
+	}
+	sort.Slice(removedRoles, func(i, j int) bool { return plan.Removed[removedRoles[i]] > plan.Removed[removedRoles[j]] })
+
+	response := fmt.Sprintf("Участников: %d\nУ кого будут сняты роли: %d\n", len(plan.Members), len(plan.Removals))
+	for _, roleID := range removedRoles {
+		response += fmt.Sprintf("<@&%s>: %d\n", roleID, plan.Removed[roleID])
+	}
+	response += "\nСохраняемые роли: " + formatRoleList(plan.Preserved) + "\n"
+	response += "Роли интеграций и ботов: " + formatRoleList(plan.Managed) + "\n"
+	response += "Роли не ниже роли бота: " + formatRoleList(plan.AboveBot) + "\n"
+	return response
+}
+
+// Упоминания ролей через запятую или "нет"
+func formatRoleList(roleIDs []string) string {
+	if len(roleIDs) == 0 {
+		return "нет"
+	}
+	return "<@&" + strings.Join(roleIDs, ">, <@&") + ">"
+}
+
+// Роли без исключённых
+func withoutRoles(roles, excluded []string) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, roleID := range excluded {
+		skip[roleID] = true
+	}
+
+	result := []string{}
+	for _, roleID := range roles {
+		if !skip[roleID] {
+			result = append(result, roleID)
+		}
+	}
+	return result
+}
+
+// Обработка команды !restoreRoles [snapshot]
+func (sc *ServerConfig) handleRestoreRolesCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	if len(call.Args) == 0 {
+		sc.showRoleSnapshots(s, m)
+		return
+	}
+
+	snapshotID, _ := strconv.ParseInt(call.Args[0], 10, 64)
+	snapshot, err := loadRoleSnapshot(sc.GuildID, snapshotID)
+	if err != nil {
+		logger.Error("Ошибка загрузки снимка ролей: " + err.Error())
+		reply(s, m, "Ошибка загрузки снимка ролей: "+err.Error())
+		return
+	}
+	if snapshot == nil {
+		reply(s, m, fmt.Sprintf("Снимок ролей #%d не найден. Список снимков: `!restoreRoles`", snapshotID))
+		return
+	}
+
+	roles, err := s.GuildRoles(sc.GuildID)
+	if err != nil {
+		reply(s, m, "Ошибка получения ролей: "+err.Error())
+		return
+	}
+	members, err := fetchGuildMembers(s, sc.GuildID)
+	if err != nil {
+		reply(s, m, "Ошибка получения списка участников: "+err.Error())
+		return
+	}
+
+	// Возвращаются только существующие роли, которыми бот может управлять
+	botPosition := botTopRolePosition(s, sc.GuildID, roles)
+	assignable := make(map[string]bool)
+	for _, role := range roles {
+		if role.ID != sc.GuildID && !role.Managed && role.Position < botPosition {
+			assignable[role.ID] = true
+		}
+	}
+
+	reply(s, m, fmt.Sprintf("Восстанавливаю роли из снимка #%d... Это может занять время", snapshot.ID))
+
+	restoredCount, failCount, absentCount := 0, 0, 0
+	present := make(map[string]*discordgo.Member, len(members))
+	for _, member := range members {
+		present[member.User.ID] = member
+	}
+	for userID, snapshotRoles := range snapshot.Roles {
+		member, exists := present[userID]
+		if !exists {
+			absentCount++
+			continue
+		}
+
+		missing := []string{}
+		for _, roleID := range withoutRoles(snapshotRoles, member.Roles) {
+			if assignable[roleID] {
+				missing = append(missing, roleID)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		newRoles := append(append([]string{}, member.Roles...), missing...)
+		_, err := s.GuildMemberEdit(sc.GuildID, userID, &discordgo.GuildMemberParams{
+			Roles: &newRoles,
+		})
+		if err != nil {
+			logger.Error("Ошибка восстановления ролей у " + member.User.Username + ": " + err.Error())
+			failCount++
+		} else {
+			restoredCount++
+		}
+
+		// Задержка для предотвращения лимитов
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if err := markRoleSnapshotRestored(snapshot.ID); err != nil {
+		logger.Error("Ошибка обновления снимка ролей: " + err.Error())
+	}
+
+	reply(s, m, fmt.Sprintf(
+		"Восстановление ролей завершено!\nВосстановлено: %d\nНе удалось: %d\nПокинули сервер: %d",
+		restoredCount, failCount, absentCount))
+}
+
+// Список последних снимков ролей сервера
+func (sc *ServerConfig) showRoleSnapshots(s *discordgo.Session, m *discordgo.MessageCreate) {
+	snapshots, err := loadRoleSnapshots(sc.GuildID, roleSnapshotsShown)
+	if err != nil {
+		logger.Error("Ошибка загрузки снимков ролей: " + err.Error())
+		reply(s, m, "Ошибка загрузки снимков ролей: "+err.Error())
+		return
+	}
+	if len(snapshots) == 0 {
+		reply(s, m, "Снимков ролей нет. Снимок сохраняется перед каждой очисткой `!clsRoles`")
+		return
+	}
+
+	response := "**Снимки ролей:**\n"
+	for _, snapshot := range snapshots {
+		response += fmt.Sprintf("#%d - %s, <@%s>, участников: %d", snapshot.ID,
+			time.Unix(snapshot.CreatedAt, 0).Format("2006-01-02 15:04"), snapshot.ActorID, len(snapshot.Roles))
+		if snapshot.RestoredAt > 0 {
+			response += ", восстановлен " + time.Unix(snapshot.RestoredAt, 0).Format("2006-01-02 15:04")
+		}
+		response += "\n"
+	}
+	response += "\nВосстановить: `!restoreRoles <номер>`"
+	reply(s, m, response)
+}
+
+// Сохранение снимка ролей в БД
+func saveRoleSnapshot(snapshot *roleSnapshot) error {
+	rolesJSON, err := json.Marshal(snapshot.Roles)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO role_snapshots (guild_id, actor_id, roles_json, created_at)
+		VALUES (?, ?, ?, ?)`,
+		snapshot.GuildID, snapshot.ActorID, string(rolesJSON), snapshot.CreatedAt)
+	if err != nil {
+		return err
+	}
+	snapshot.ID, err = result.LastInsertId()
+	return err
+}
+
+// Загрузка снимка ролей сервера. Возвращает nil, если снимка нет
+func loadRoleSnapshot(guildID string, id int64) (*roleSnapshot, error) {
+	row := db.QueryRow(`
+		SELECT id, guild_id, actor_id, roles_json, created_at, restored_at
+		FROM role_snapshots WHERE guild_id = ? AND id = ?`, guildID, id)
+	snapshot, err := scanRoleSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// Последние снимки ролей сервера
+func loadRoleSnapshots(guildID string, limit int) ([]*roleSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT id, guild_id, actor_id, roles_json, created_at, restored_at
+		FROM role_snapshots WHERE guild_id = ? ORDER BY id DESC LIMIT ?`, guildID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []*roleSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanRoleSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Чтение снимка ролей из строки запроса
+func scanRoleSnapshot(row interface{ Scan(...any) error }) (*roleSnapshot, error) {
+	snapshot := &roleSnapshot{}
+	var rolesJSON string
+	if err := row.Scan(&snapshot.ID, &snapshot.GuildID, &snapshot.ActorID, &rolesJSON, &snapshot.CreatedAt, &snapshot.RestoredAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rolesJSON), &snapshot.Roles); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Отметка о восстановлении ролей из снимка
+func markRoleSnapshotRestored(id int64) error {
+	_, err := db.Exec("UPDATE role_snapshots SET restored_at = ? WHERE id = ?", time.Now().Unix(), id)
+	return err
+}
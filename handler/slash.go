@@ -0,0 +1,445 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Вызов команды, ответы на который собираются для журнала аудита
+type commandInvocation struct {
+	interaction *discordgo.Interaction // nil для префиксной команды
+	replies     []string
+}
+
+var (
+	commandInvocations = make(map[string]*commandInvocation) // ID сообщения команды -> вызов
+	invocationsMu      sync.Mutex
+)
+
+// Начало сбора ответов на команду. Возвращает функцию, завершающую сбор
+func trackCommand(m *discordgo.MessageCreate, interaction *discordgo.Interaction) func() {
+	invocationsMu.Lock()
+	defer invocationsMu.Unlock()
+	if _, exists := commandInvocations[m.ID]; exists {
+		return func() {}
+	}
+
+	commandInvocations[m.ID] = &commandInvocation{interaction: interaction}
+	return func() {
+		invocationsMu.Lock()
+		delete(commandInvocations, m.ID)
+		invocationsMu.Unlock()
+	}
+}
+
+// Ответ на команду: сообщением в канал для префиксной команды,
+// скрытым сообщением для слэш-команды
+func reply(s *discordgo.Session, m *discordgo.MessageCreate, content string) {
+	replyComplex(s, m, &discordgo.MessageSend{Content: content})
+}
+
+// Ответ на команду с вложениями
+func replyComplex(s *discordgo.Session, m *discordgo.MessageCreate, data *discordgo.MessageSend) error {
+	invocationsMu.Lock()
+	invocation, tracked := commandInvocations[m.ID]
+	if tracked {
+		invocation.replies = append(invocation.replies, data.Content)
+	}
+	invocationsMu.Unlock()
+
+	if !tracked || invocation.interaction == nil {
+		_, err := s.ChannelMessageSendComplex(m.ChannelID, data)
+		return err
+	}
+
+	_, err := s.FollowupMessageCreate(invocation.interaction, true, &discordgo.WebhookParams{
+		Content: data.Content,
+		Files:   data.Files,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		logger.Error("Ошибка ответа на слэш-команду: " + err.Error())
+	}
+	return err
+}
+
+// Ответы, отправленные на команду с начала сбора
+func commandReplies(m *discordgo.MessageCreate) []string {
+	invocationsMu.Lock()
+	defer invocationsMu.Unlock()
+	if invocation, tracked := commandInvocations[m.ID]; tracked {
+		return append([]string{}, invocation.replies...)
+	}
+	return nil
+}
+
+// Наибольшее число параметров или подкоманд слэш-команды в Discord
+const maxSlashOptions = 25
+
+// Описания слэш-команд, объединяющих несколько команд
+var slashGroupDescriptions = map[string]string{
+	"registration": "Управление регистрацией",
+	"roles":        "Управление ролями",
+}
+
+// Регистрация слэш-команд
+func RegisterSlashCommands(s *discordgo.Session) {
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", slashCommands()); err != nil {
+		logger.Error("Ошибка регистрации слэш-команд: " + err.Error())
+		return
+	}
+	logger.Info("Слэш-команды зарегистрированы")
+}
+
+// Обработка слэш-команд и автодополнения их параметров
+func HandleApplicationCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.GuildID == "" || i.Member == nil {
+		return
+	}
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		runSlashCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocompleteSlashCommand(s, i)
+	}
+}
+
+// Выполнение слэш-команды через реестр команд
+func runSlashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	call, options := slashCommandCall(data)
+	if call == nil {
+		respondEphemeral(s, i, "Неизвестная команда")
+		return
+	}
+
+	// Как и команды с "!", слэш-команды работают только в канале команд, если он задан
+	if serverConfig, exists := GetServerConfig(i.GuildID); exists &&
+		serverConfig.CommandChannelID != "" && i.ChannelID != serverConfig.CommandChannelID {
+		respondEphemeral(s, i, fmt.Sprintf("Команды доступны только в канале <#%s>", serverConfig.CommandChannelID))
+		return
+	}
+
+	attachments := []*discordgo.MessageAttachment{}
+	if option := findSlashOption(options, "file"); option != nil && data.Resolved != nil {
+		if attachment, exists := data.Resolved.Attachments[slashOptionValue(option)]; exists {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	// Команда может выполняться дольше трёх секунд, поэтому ответ откладывается
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		logger.Error("Ошибка ответа на взаимодействие: " + err.Error())
+		return
+	}
+
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:          i.ID,
+		ChannelID:   i.ChannelID,
+		GuildID:     i.GuildID,
+		Author:      i.Member.User,
+		Member:      i.Member,
+		Content:     call.String(),
+		Attachments: attachments,
+	}}
+
+	defer trackCommand(m, i.Interaction)()
+
+	logger.Info("Пользователь ID:" + m.Author.ID + " вызвал слэш-команду /" + data.Name + " (" + m.Content + ")")
+	if err := call.normalize(); err != nil {
+		reply(s, m, err.Error())
+	} else {
+		auditCommand(s, m, i.GuildID, func() { executeCommand(s, m, i.GuildID, call) })
+	}
+
+	if len(commandReplies(m)) == 0 {
+		reply(s, m, "Готово")
+	}
+}
+
+// Вызов команды реестра, соответствующий слэш-команде, и параметры этой команды
+func slashCommandCall(data discordgo.ApplicationCommandInteractionData) (*commandCall, []*discordgo.ApplicationCommandInteractionDataOption) {
+	options := data.Options
+	subName := ""
+	if len(options) > 0 && options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		subName = options[0].Name
+		options = options[0].Options
+	}
+
+	for _, spec := range commandRegistry {
+		var call *commandCall
+		switch {
+		case spec.Slash == strings.TrimSpace(data.Name+" "+subName):
+			call = &commandCall{Spec: spec, Path: []string{spec.Name}}
+		case spec.Slash == data.Name && subName != "":
+			sub := spec.findSubcommand(subName)
+			if sub == nil {
+				return nil, nil
+			}
+			call = &commandCall{Spec: sub, Path: []string{spec.Name, sub.Name}}
+		default:
+			continue
+		}
+
+		call.Flags = make(map[string]string)
+		for _, arg := range call.Spec.Args {
+			option := findSlashOption(options, slashOptionName(arg.Name))
+			if option == nil {
+				break
+			}
+			call.Args = append(call.Args, slashOptionValue(option))
+		}
+		for _, flag := range call.Spec.Flags {
+			option := findSlashOption(options, slashOptionName(flag.Name))
+			if option == nil || (flag.Value == "" && !option.BoolValue()) {
+				continue
+			}
+			call.Flags[flag.Name] = slashOptionValue(option)
+		}
+		return call, options
+	}
+	return nil, nil
+}
+
+// Поиск параметра слэш-команды по имени
+func findSlashOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+// Значение параметра в виде аргумента префиксной команды:
+// для пользователей, ролей, каналов и файлов - их ID
+func slashOptionValue(option *discordgo.ApplicationCommandInteractionDataOption) string {
+	switch option.Type {
+	case discordgo.ApplicationCommandOptionInteger:
+		return strconv.FormatInt(option.IntValue(), 10)
+	case discordgo.ApplicationCommandOptionBoolean:
+		return strconv.FormatBool(option.BoolValue())
+	default:
+		return fmt.Sprint(option.Value)
+	}
+}
+
+// Подсказки названий форм для параметров с типом argForm
+func autocompleteSlashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	call, options := slashCommandCall(i.ApplicationCommandData())
+	focused := focusedSlashOption(options)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+
+	if call != nil && focused != nil && call.Spec.optionKind(focused.Name) == argForm {
+		prefix := strings.ToLower(focused.StringValue())
+		for _, form := range ListRegistrationForms(i.GuildID) {
+			if !strings.HasPrefix(form.FormName(), prefix) {
+				continue
+			}
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  form.DisplayTitle() + " (" + form.FormName() + ")",
+				Value: form.FormName(),
+			})
+			if len(choices) == 25 {
+				break
+			}
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		logger.Error("Ошибка ответа на автодополнение: " + err.Error())
+	}
+}
+
+// Параметр, который сейчас вводит пользователь
+func focusedSlashOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Focused {
+			return option
+		}
+	}
+	return nil
+}
+
+// Тип аргумента или флага команды по имени параметра слэш-команды
+func (spec *commandSpec) optionKind(name string) string {
+	for _, arg := range spec.Args {
+		if slashOptionName(arg.Name) == name {
+			return arg.Kind
+		}
+	}
+	for _, flag := range spec.Flags {
+		if slashOptionName(flag.Name) == name {
+			return flag.Kind
+		}
+	}
+	return ""
+}
+
+// Имя параметра слэш-команды: строчные латинские буквы, цифры, "_" и "-"
+func slashOptionName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// Обрезка описания до допустимой для Discord длины
+func slashDescription(description string) string {
+	if runes := []rune(description); len(runes) > 100 {
+		return string(runes[:97]) + "..."
+	}
+	return description
+}
+
+// Описание слэш-команд по реестру команд
+func slashCommands() []*discordgo.ApplicationCommand {
+	commands := []*discordgo.ApplicationCommand{}
+	grouped := make(map[string]*discordgo.ApplicationCommand)
+
+	for _, spec := range commandRegistry {
+		if spec.Slash == "" {
+			continue
+		}
+		name, subName, isSub := strings.Cut(spec.Slash, " ")
+
+		if !isSub {
+			command := &discordgo.ApplicationCommand{Name: name, Description: slashDescription(spec.Description)}
+			if len(spec.Subcommands) > 0 {
+				for _, sub := range spec.Subcommands {
+					if !sub.PrefixOnly {
+						command.Options = append(command.Options, sub.slashSubcommand(sub.Name))
+					}
+				}
+			} else {
+				command.Options = spec.slashOptions()
+			}
+			commands = append(commands, command)
+			continue
+		}
+
+		command, exists := grouped[name]
+		if !exists {
+			command = &discordgo.ApplicationCommand{Name: name, Description: slashGroupDescriptions[name]}
+			grouped[name] = command
+			commands = append(commands, command)
+		}
+		command.Options = append(command.Options, spec.slashSubcommand(subName))
+	}
+
+	// Discord отклоняет весь набор команд, если хотя бы в одной больше 25 параметров,
+	// поэтому такая команда не регистрируется, а остальные продолжают работать
+	accepted := []*discordgo.ApplicationCommand{}
+	for _, command := range commands {
+		if overflow := slashOptionsOverflow(command.Name, command.Options); overflow != "" {
+			logger.Error(fmt.Sprintf("Слэш-команда /%s не зарегистрирована: больше %d параметров в /%s", command.Name, maxSlashOptions, overflow))
+			continue
+		}
+		accepted = append(accepted, command)
+	}
+	return accepted
+}
+
+// Имя команды или подкоманды, в которой параметров больше допустимого, или пустая строка
+func slashOptionsOverflow(name string, options []*discordgo.ApplicationCommandOption) string {
+	if len(options) > maxSlashOptions {
+		return name
+	}
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand {
+			if overflow := slashOptionsOverflow(name+" "+option.Name, option.Options); overflow != "" {
+				return overflow
+			}
+		}
+	}
+	return ""
+}
+
+// Подкоманда слэш-команды
+func (spec *commandSpec) slashSubcommand(name string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        name,
+		Description: slashDescription(spec.Description),
+		Options:     spec.slashOptions(),
+	}
+}
+
+// Параметры слэш-команды: аргументы, флаги и вложение. Обязательные идут первыми
+func (spec *commandSpec) slashOptions() []*discordgo.ApplicationCommandOption {
+	options := []*discordgo.ApplicationCommandOption{}
+	for _, arg := range spec.Args {
+		options = append(options, slashOption(arg.Name, arg.Description, arg.Kind, arg.Required, arg.Choices))
+	}
+	for _, flag := range spec.Flags {
+		option := slashOption(flag.Name, flag.Description, flag.Kind, false, flag.Choices)
+		if flag.Value == "" {
+			option.Type = discordgo.ApplicationCommandOptionBoolean
+		}
+		options = append(options, option)
+	}
+	if spec.Attachment != "" {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Name:        "file",
+			Description: slashDescription(spec.Attachment),
+			Required:    true,
+		})
+	}
+
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Required && !options[j].Required })
+	return options
+}
+
+// Параметр слэш-команды по типу аргумента
+func slashOption(name, description, kind string, required bool, choices []string) *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        slashOptionName(name),
+		Description: slashDescription(description),
+		Required:    required,
+	}
+
+	switch kind {
+	case argInteger:
+		minValue := 0.0
+		option.Type = discordgo.ApplicationCommandOptionInteger
+		option.MinValue = &minValue
+	case argUser:
+		option.Type = discordgo.ApplicationCommandOptionUser
+	case argRole:
+		option.Type = discordgo.ApplicationCommandOptionRole
+	case argChannel:
+		option.Type = discordgo.ApplicationCommandOptionChannel
+		option.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildText}
+	case argCategory:
+		option.Type = discordgo.ApplicationCommandOptionChannel
+		option.ChannelTypes = []discordgo.ChannelType{discordgo.ChannelTypeGuildCategory}
+	case argForm:
+		option.Autocomplete = true
+	}
+
+	for _, choice := range choices {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+	}
+	return option
+}
@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Окно статистики по умолчанию
+const defaultStatsWindow = 7 * 24 * time.Hour
+
+// Сколько вопросов и вариантов показывать в разделах статистики
+const (
+	maxStatsQuestions = 10
+	maxStatsOptions   = 3
+)
+
+// Статистика по одному вопросу формы
+type questionStats struct {
+	Form      string
+	ID        string
+	Reached   int
+	Dropped   int
+	Durations []int64
+	Options   map[string]int
+}
+
+// Сводная статистика регистраций за период
+type registrationStats struct {
+	Started   int
+	Active    int
+	Outcomes  map[string]int
+	Totals    []int64
+	Questions map[string]*questionStats // form/question_id -> статистика
+}
+
+// Обработка команды !stats [7d|30d]
+func (sc *ServerConfig) handleStatsCommand(s *discordgo.Session, m *discordgo.MessageCreate, call *commandCall) {
+	window := defaultStatsWindow
+	label := "7d"
+	if len(call.Args) > 0 {
+		parsed, err := parseStatsWindow(call.Args[0])
+		if err != nil {
+			reply(s, m, "Период указывается в днях, например `7d` или `30d`")
+			return
+		}
+		window, label = parsed, strings.ToLower(call.Args[0])
+	}
+
+	stats, err := collectRegistrationStats(sc.GuildID, time.Now().Add(-window).Unix())
+	if err != nil {
+		logger.Error("Ошибка сбора статистики: " + err.Error())
+		reply(s, m, "Ошибка сбора статистики: "+err.Error())
+		return
+	}
+
+	reply(s, m, stats.format(sc.GuildID, label))
+}
+
+// Разбор окна статистики вида 7d
+func parseStatsWindow(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !strings.HasSuffix(value, "d") {
+		return 0, fmt.Errorf("неверный период: %s", value)
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if err != nil || days <= 0 || days > 365 {
+		return 0, fmt.Errorf("неверный период: %s", value)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// Сбор статистики из истории регистраций и активных сессий
+func collectRegistrationStats(guildID string, since int64) (*registrationStats, error) {
+	stats := &registrationStats{
+		Outcomes:  make(map[string]int),
+		Questions: make(map[string]*questionStats),
+	}
+
+	rows, err := db.Query(`
+		SELECT outcome, session_json, started_at, finished_at FROM registration_history
+		WHERE guild_id = ? AND finished_at >= ?`, guildID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var outcome, sessionJSON string
+		var startedAt, finishedAt int64
+		if err := rows.Scan(&outcome, &sessionJSON, &startedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		stats.Outcomes[outcome]++
+
+		// Восстановленные и импортированные участники не проходили вопросы
+		if outcome == OutcomeRestored || outcome == OutcomeImported {
+			continue
+		}
+		if startedAt >= since {
+			stats.Started++
+		}
+
+		var session UserSession
+		if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+			logger.Error("Ошибка разбора сессии из истории: " + err.Error())
+			continue
+		}
+		stats.addSession(&session, outcome)
+
+		if outcome == OutcomeCompleted && finishedAt > startedAt {
+			stats.Totals = append(stats.Totals, finishedAt-startedAt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	for _, session := range registeringUsers {
+		if session.GuildID != guildID {
+			continue
+		}
+		stats.Active++
+		if session.StartedAt >= since {
+			stats.Started++
+		}
+	}
+	mu.Unlock()
+
+	return stats, nil
+}
+
+// Учёт ответов и места выхода из регистрации одной сессии
+func (stats *registrationStats) addSession(session *UserSession, outcome string) {
+	formName := normalizeFormName(session.FormName)
+	form, _ := GetRegistrationForm(session.GuildID, formName)
+
+	question := func(id string) *questionStats {
+		key := formName + "/" + id
+		if stats.Questions[key] == nil {
+			stats.Questions[key] = &questionStats{Form: formName, ID: id, Options: make(map[string]int)}
+		}
+		return stats.Questions[key]
+	}
+
+	answers := make([]UserAnswer, 0, len(session.Answers))
+	for _, answer := range session.Answers {
+		answers = append(answers, answer)
+	}
+	sort.Slice(answers, func(i, j int) bool { return answers[i].AnsweredAt < answers[j].AnsweredAt })
+
+	previous := session.StartedAt
+	for _, answer := range answers {
+		current := question(answer.QuestionID)
+		current.Reached++
+
+		if answer.AnsweredAt > 0 {
+			if previous > 0 && answer.AnsweredAt >= previous {
+				current.Durations = append(current.Durations, answer.AnsweredAt-previous)
+			}
+			previous = answer.AnsweredAt
+		}
+
+		if isChoiceQuestion(form, answer.QuestionID) {
+			current.Options[formatAnswer(answer)]++
+		}
+	}
+
+	// Вопрос, на котором пользователь прекратил регистрацию
+	if outcome != OutcomeCompleted && session.CurrentQID != "" {
+		if _, answered := session.Answers[session.CurrentQID]; !answered {
+			current := question(session.CurrentQID)
+			current.Reached++
+			current.Dropped++
+		}
+	}
+}
+
+// Проверка, что вопрос формы предлагает варианты ответа
+func isChoiceQuestion(form *RegistrationConfig, questionID string) bool {
+	if form == nil {
+		return false
+	}
+	for _, question := range form.Questions {
+		if question.ID == questionID {
+			return question.Type == "single_choice" || question.Type == "multiple_choice"
+		}
+	}
+	return false
+}
+
+// Текст вопроса для отчёта
+func questionLabel(guildID string, question *questionStats) string {
+	label := question.ID
+	if question.ID == restoreQuestionID {
+		label = "предложение восстановления"
+	} else if form, exists := GetRegistrationForm(guildID, question.Form); exists {
+		for _, q := range form.Questions {
+			if q.ID == question.ID && q.Text != "" {
+				label = q.Text
+				break
+			}
+		}
+	}
+
+	label = strings.ReplaceAll(label, "\n", " ")
+	if runes := []rune(label); len(runes) > 60 {
+		label = string(runes[:57]) + "..."
+	}
+	if question.Form != DefaultFormName {
+		label = "[" + question.Form + "] " + label
+	}
+	return label
+}
+
+// Медиана длительностей в секундах
+func medianDuration(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Форматирование длительности для отчёта
+func formatStatsDuration(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// Форматирование статистики для отправки в канал
+func (stats *registrationStats) format(guildID, label string) string {
+	completed := stats.Outcomes[OutcomeCompleted]
+	abandoned := stats.Outcomes[OutcomeAbandoned]
+	rejected := stats.Outcomes[OutcomeRejected]
+
+	response := fmt.Sprintf("**Статистика регистраций за %s:**\nНачато: %d\nЗавершено: %d\nПокинули сервер: %d\nПрервано администратором: %d\nВ процессе: %d\n",
+		label, stats.Started, completed, abandoned, rejected, stats.Active)
+	if restored, imported := stats.Outcomes[OutcomeRestored], stats.Outcomes[OutcomeImported]; restored+imported > 0 {
+		response += fmt.Sprintf("Восстановлено: %d\nИмпортировано: %d\n", restored, imported)
+	}
+	if finished := completed + abandoned + rejected; finished > 0 {
+		response += fmt.Sprintf("Конверсия: %.1f%%\n", float64(completed)*100/float64(finished))
+	}
+	if len(stats.Totals) > 0 {
+		response += fmt.Sprintf("Медианное время регистрации: %s\n", formatStatsDuration(medianDuration(stats.Totals)))
+	}
+
+	questions := make([]*questionStats, 0, len(stats.Questions))
+	for _, question := range stats.Questions {
+		questions = append(questions, question)
+	}
+	if len(questions) == 0 {
+		return response
+	}
+
+	// Отток по вопросам: сначала вопросы с наибольшей долей ушедших
+	sort.Slice(questions, func(i, j int) bool {
+		left := float64(questions[i].Dropped) / float64(questions[i].Reached)
+		right := float64(questions[j].Dropped) / float64(questions[j].Reached)
+		if left != right {
+			return left > right
+		}
+		return questions[i].Reached > questions[j].Reached
+	})
+
+	response += "\n**Вопросы (отток / медианное время):**\n"
+	for i, question := range questions {
+		if i == maxStatsQuestions {
+			response += fmt.Sprintf("...и ещё %d\n", len(questions)-maxStatsQuestions)
+			break
+		}
+		response += fmt.Sprintf("%s - %d/%d (%.1f%%)", questionLabel(guildID, question),
+			question.Dropped, question.Reached, float64(question.Dropped)*100/float64(question.Reached))
+		if len(question.Durations) > 0 {
+			response += ", " + formatStatsDuration(medianDuration(question.Durations))
+		}
+		response += "\n"
+	}
+
+	popular := ""
+	shown := 0
+	for _, question := range questions {
+		if len(question.Options) == 0 || shown == maxStatsQuestions {
+			continue
+		}
+		shown++
+
+		options := make([]string, 0, len(question.Options))
+		for option := range question.Options {
+			options = append(options, option)
+		}
+		sort.Slice(options, func(i, j int) bool {
+			if question.Options[options[i]] != question.Options[options[j]] {
+				return question.Options[options[i]] > question.Options[options[j]]
+			}
+			return options[i] < options[j]
+		})
+		if len(options) > maxStatsOptions {
+			options = options[:maxStatsOptions]
+		}
+
+		parts := make([]string, 0, len(options))
+		for _, option := range options {
+			parts = append(parts, fmt.Sprintf("%s (%d)", option, question.Options[option]))
+		}
+		popular += questionLabel(guildID, question) + ": " + strings.Join(parts, ", ") + "\n"
+	}
+	if popular != "" {
+		response += "\n**Популярные ответы:**\n" + popular
+	}
+
+	// Ограничение Discord на длину сообщения
+	if runes := []rune(response); len(runes) > 2000 {
+		response = string(runes[:1997]) + "..."
+	}
+	return response
+}
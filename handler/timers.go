@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Типы отложенных задач
+const (
+	taskCloseChannel  = "close_channel"  // закрыть канал завершённой регистрации по политике сервера
+	taskDeleteChannel = "delete_channel" // удалить архивный канал
+)
+
+// Отложенная задача. Хранится в БД, чтобы пережить перезапуск бота
+type scheduledTask struct {
+	ID        int64
+	GuildID   string
+	UserID    string
+	ChannelID string
+	Action    string
+	RunAt     int64
+}
+
+// Запланированная задача вместе с её таймером
+type pendingTask struct {
+	task  *scheduledTask
+	timer *time.Timer
+}
+
+// Планирование задачи: запись в БД и запуск таймера
+func scheduleTask(s *discordgo.Session, task *scheduledTask) error {
+	result, err := db.Exec(`
+		INSERT INTO scheduled_tasks (guild_id, user_id, channel_id, action, run_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		task.GuildID, task.UserID, task.ChannelID, task.Action, task.RunAt)
+	if err != nil {
+		return err
+	}
+
+	task.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	armTask(s, task)
+	return nil
+}
+
+// Запуск таймера задачи
+func armTask(s *discordgo.Session, task *scheduledTask) {
+	timersMu.Lock()
+	defer timersMu.Unlock()
+
+	pending := &pendingTask{task: task}
+	pending.timer = time.AfterFunc(time.Until(time.Unix(task.RunAt, 0)), func() {
+		timersMu.Lock()
+		_, exists := pendingTimers[task.ID]
+		delete(pendingTimers, task.ID)
+		timersMu.Unlock()
+
+		// Задачу успели отменить
+		if !exists {
+			return
+		}
+		runTask(s, task)
+	})
+	pendingTimers[task.ID] = pending
+}
+
+// Выполнение задачи и удаление её из БД
+func runTask(s *discordgo.Session, task *scheduledTask) {
+	if _, err := db.Exec("DELETE FROM scheduled_tasks WHERE id = ?", task.ID); err != nil {
+		logger.Error("Ошибка удаления задачи из БД: " + err.Error())
+	}
+
+	switch task.Action {
+	case taskCloseChannel:
+		serverConfig, exists := GetServerConfig(task.GuildID)
+		if !exists {
+			serverConfig = &ServerConfig{GuildID: task.GuildID}
+		}
+		serverConfig.closeRegistrationChannel(s, task.ChannelID, task.UserID)
+
+	case taskDeleteChannel:
+		if _, err := s.ChannelDelete(task.ChannelID); err != nil {
+			logger.Error("Ошибка удаления архивного канала " + task.ChannelID + ": " + err.Error())
+		}
+
+	default:
+		logger.Error("Неизвестный тип отложенной задачи: " + task.Action)
+	}
+}
+
+// Отмена задач пользователя указанного типа. Возвращает отменённые задачи
+func cancelUserTasks(guildID, userID, action string) []*scheduledTask {
+	timersMu.Lock()
+	cancelled := []*scheduledTask{}
+	for id, pending := range pendingTimers {
+		task := pending.task
+		if task.GuildID != guildID || task.UserID != userID || task.Action != action {
+			continue
+		}
+		pending.timer.Stop()
+		delete(pendingTimers, id)
+		cancelled = append(cancelled, task)
+	}
+	timersMu.Unlock()
+
+	for _, task := range cancelled {
+		if _, err := db.Exec("DELETE FROM scheduled_tasks WHERE id = ?", task.ID); err != nil {
+			logger.Error("Ошибка удаления задачи из БД: " + err.Error())
+		}
+	}
+	return cancelled
+}
+
+// Восстановление отложенных задач после перезапуска.
+// Просроченные задачи выполняются сразу
+func RestoreScheduledTasks(s *discordgo.Session) error {
+	rows, err := db.Query("SELECT id, guild_id, user_id, channel_id, action, run_at FROM scheduled_tasks")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tasks := []*scheduledTask{}
+	for rows.Next() {
+		task := &scheduledTask{}
+		if err := rows.Scan(&task.ID, &task.GuildID, &task.UserID, &task.ChannelID, &task.Action, &task.RunAt); err != nil {
+			return err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		armTask(s, task)
+	}
+	return nil
+}
@@ -41,6 +41,35 @@ func findRoleID(s *discordgo.Session, guildID, roleID string) string {
 	return ""
 }
 
+// Получение всех участников сервера постранично
+func fetchGuildMembers(s *discordgo.Session, guildID string) ([]*discordgo.Member, error) {
+	members := []*discordgo.Member{}
+	after := ""
+	for {
+		page, err := s.GuildMembers(guildID, after, 1000)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, page...)
+		if len(page) < 1000 {
+			return members, nil
+		}
+		after = page[len(page)-1].User.ID
+	}
+}
+
+// Получение ID пользователя из упоминания <@id>, <@!id> или самого ID
+func parseUserID(arg string) string {
+	arg = strings.TrimPrefix(arg, "<@")
+	arg = strings.TrimPrefix(arg, "!")
+	return strings.TrimSuffix(arg, ">")
+}
+
+// Получение ID роли из упоминания <@&id> или самого ID
+func parseRoleID(arg string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(arg, "<@&"), ">")
+}
+
 // Инициализация базы данных
 func InitDB() error {
 	var err error
@@ -59,6 +88,68 @@ func InitDB() error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS registration_forms(
+		guild_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		config_json TEXT NOT NULL CHECK(json_valid(config_json)),
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (guild_id, name)
+	);
+	CREATE TABLE IF NOT EXISTS registration_history(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		outcome TEXT NOT NULL,
+		session_json TEXT NOT NULL CHECK(json_valid(session_json)),
+		started_at INTEGER NOT NULL,
+		finished_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_registration_history_guild ON registration_history(guild_id, user_id);
+	CREATE TABLE IF NOT EXISTS scheduled_tasks(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		run_at INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS member_profiles(
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		fields_json TEXT NOT NULL CHECK(json_valid(fields_json)),
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (guild_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS member_registrations(
+		guild_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		session_json TEXT NOT NULL CHECK(json_valid(session_json)),
+		roles_json TEXT NOT NULL CHECK(json_valid(roles_json)),
+		nickname TEXT NOT NULL DEFAULT '',
+		completed_at INTEGER NOT NULL,
+		PRIMARY KEY (guild_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS audit_log(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		actor_id TEXT NOT NULL,
+		actor_name TEXT NOT NULL DEFAULT '',
+		command TEXT NOT NULL,
+		arguments TEXT NOT NULL DEFAULT '',
+		config_before TEXT NOT NULL DEFAULT '',
+		config_after TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_guild ON audit_log(guild_id, created_at);
+	CREATE TABLE IF NOT EXISTS role_snapshots(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		actor_id TEXT NOT NULL,
+		roles_json TEXT NOT NULL CHECK(json_valid(roles_json)),
+		created_at INTEGER NOT NULL,
+		restored_at INTEGER NOT NULL DEFAULT 0
+	);
 	`
 	_, err = db.Exec(createTableSQL)
 	if err != nil {
@@ -66,7 +157,14 @@ func InitDB() error {
 	}
 
 	// Загрузка конфигураций в память
-	return LoadConfigsFromDB()
+	if err := LoadConfigsFromDB(); err != nil {
+		return err
+	}
+	if err := loadFormsFromDB(); err != nil {
+		return err
+	}
+	configsLoaded.Store(true)
+	return nil
 }
 
 // Загрузка конфигураций из базы данных
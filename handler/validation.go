@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Допустимые типы вопросов, переходов и действий
+var (
+	questionTypes = map[string]bool{"single_choice": true, "multiple_choice": true, "text_input": true, "number_input": true}
+	nextTypes     = map[string]bool{"static": true, "conditional": true, "end": true}
+	actionTypes   = map[string]bool{"assign_role": true, "save_answer": true, "change_nickname": true}
+)
+
+// Ошибка проверки конфигурации или формы
+type validationError struct {
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+// Создание ошибки проверки
+func invalidf(format string, args ...any) error {
+	return &validationError{message: fmt.Sprintf(format, args...)}
+}
+
+// Является ли ошибка ошибкой проверки, а не ошибкой сохранения
+func isValidationError(err error) bool {
+	var target *validationError
+	return errors.As(err, &target)
+}
+
+// Проверка конфигурации сервера перед сохранением
+func validateServerConfig(sc *ServerConfig) error {
+	if sc.GuildID == "" {
+		return invalidf("не указан guild_id")
+	}
+	if sc.ReturningPolicy != "" && !isValidReturningPolicy(sc.ReturningPolicy) {
+		return invalidf("неизвестная политика returning_policy: %s", sc.ReturningPolicy)
+	}
+	if sc.ChannelPolicy != "" && !isValidChannelPolicy(sc.ChannelPolicy) {
+		return invalidf("неизвестная политика channel_policy: %s", sc.ChannelPolicy)
+	}
+	if sc.ChannelPolicy == ChannelPolicyArchive && sc.ArchiveCategoryID == "" {
+		return invalidf("channel_policy archive требует archive_category_id")
+	}
+	if sc.RegistrationMode != "" && !isValidRegistrationMode(sc.RegistrationMode) {
+		return invalidf("неизвестный режим registration_mode: %s", sc.RegistrationMode)
+	}
+	if sc.MaxConcurrentRegistrations < 0 || sc.RaidJoinLimit < 0 || sc.RaidWindowSeconds < 0 ||
+		sc.RaidPauseMinutes < 0 || sc.ChannelDeleteDelay < 0 || sc.ArchiveRetentionDays < 0 {
+		return invalidf("числовые параметры не могут быть отрицательными")
+	}
+	if _, err := parsePermissionNames(strings.Join(sc.ApplicantPermissions, ",")); err != nil {
+		return invalidf("applicant_permissions: %v", err)
+	}
+	if err := validateCommandPermissions(sc.CommandPermissions); err != nil {
+		return err
+	}
+	for _, roleID := range sc.PreservedRoles {
+		if roleID == "" {
+			return invalidf("preserved_roles: пустой ID роли")
+		}
+	}
+	for _, staffRole := range sc.StaffRoles {
+		if staffRole.RoleID == "" {
+			return invalidf("staff_roles: не указан role_id")
+		}
+		if _, err := parsePermissionNames(strings.Join(staffRole.Permissions, ",")); err != nil {
+			return invalidf("staff_roles %s: %v", staffRole.RoleID, err)
+		}
+	}
+	return nil
+}
+
+// Проверка формы регистрации перед сохранением
+func validateRegistrationForm(form *RegistrationConfig) error {
+	if len(form.Questions) == 0 {
+		return invalidf("форма не содержит вопросов")
+	}
+	if form.Trigger != "" && !isValidTrigger(form.Trigger) {
+		return invalidf("неизвестный способ запуска формы: %s", form.Trigger)
+	}
+
+	if err := validateAppearance(form.Appearance); err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool)
+	for _, question := range form.Questions {
+		if question.ID == "" {
+			return invalidf("у вопроса не указан id")
+		}
+		if question.ID == restoreQuestionID || question.ID == "end" {
+			return invalidf("id вопроса %s зарезервирован", question.ID)
+		}
+		if ids[question.ID] {
+			return invalidf("повторяющийся id вопроса: %s", question.ID)
+		}
+		ids[question.ID] = true
+	}
+
+	// Переход может вести на существующий вопрос или завершать регистрацию
+	target := func(id string) bool {
+		return id == "" || id == "end" || ids[id]
+	}
+
+	for _, question := range form.Questions {
+		if !questionTypes[question.Type] {
+			return invalidf("вопрос %s: неизвестный тип %s", question.ID, question.Type)
+		}
+		if strings.TrimSpace(question.Text) == "" {
+			return invalidf("вопрос %s: пустой текст", question.ID)
+		}
+		if err := validateAppearance(question.Appearance); err != nil {
+			return invalidf("вопрос %s: %v", question.ID, err)
+		}
+		if (question.Type == "single_choice" || question.Type == "multiple_choice") && len(question.Options) == 0 {
+			return invalidf("вопрос %s: нет вариантов ответа", question.ID)
+		}
+		if question.Validation != nil && question.Validation.Regex != "" {
+			if _, err := regexp.Compile(question.Validation.Regex); err != nil {
+				return invalidf("вопрос %s: неверное регулярное выражение: %v", question.ID, err)
+			}
+		}
+		for _, action := range question.Actions {
+			if !actionTypes[action.Type] {
+				return invalidf("вопрос %s: неизвестное действие %s", question.ID, action.Type)
+			}
+			if action.Type == "save_answer" && action.Field == "" {
+				return invalidf("вопрос %s: в save_answer не указан field", question.ID)
+			}
+			if action.Type == "save_answer" && !profileFieldPattern.MatchString(action.Field) {
+				return invalidf("вопрос %s: field %q может содержать только латинские буквы, цифры и _", question.ID, action.Field)
+			}
+		}
+
+		next := question.Next
+		if next.Type != "" && !nextTypes[next.Type] {
+			return invalidf("вопрос %s: неизвестный тип перехода %s", question.ID, next.Type)
+		}
+		if !target(next.QuestionID) || !target(next.Default) {
+			return invalidf("вопрос %s: переход на несуществующий вопрос", question.ID)
+		}
+		for _, condition := range next.Conditions {
+			if !target(condition.QuestionID) {
+				return invalidf("вопрос %s: переход на несуществующий вопрос %s", question.ID, condition.QuestionID)
+			}
+		}
+	}
+
+	for _, action := range form.Completion.Actions {
+		if !actionTypes[action.Type] {
+			return invalidf("completion: неизвестное действие %s", action.Type)
+		}
+	}
+	return validateAnnouncements(form.Completion.Announcements)
+}
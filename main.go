@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"strings"
@@ -39,8 +40,36 @@ func guildMemberAdd(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
 		return
 	}
 
-	// Вызываем метод на правильной конфигурации
-	serverConfig.NewGuildMember(s, m)
+	// Ставим участника в очередь регистрации
+	serverConfig.QueueGuildMember(s, m)
+}
+
+// Обработчик выхода участников
+func guildMemberRemove(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+	serverConfig, exists := handler.GetServerConfig(m.GuildID)
+	if !exists {
+		// Игнорируем события от незарегистрированных серверов
+		return
+	}
+
+	serverConfig.GuildMemberLeave(s, m)
+}
+
+// Обработчик взаимодействий (слэш-команды и кнопки панели регистрации)
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// Слэш-команды обрабатываются и на незарегистрированных серверах, чтобы работал /init
+	if i.Type == discordgo.InteractionApplicationCommand || i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		handler.HandleApplicationCommand(s, i)
+		return
+	}
+
+	serverConfig, exists := handler.GetServerConfig(i.GuildID)
+	if !exists {
+		// Игнорируем события от незарегистрированных серверов
+		return
+	}
+
+	serverConfig.HandleInteraction(s, i)
 }
 
 // Обработчик сообщений
@@ -114,11 +143,17 @@ func main() {
 	}
 
 	session.AddHandler(guildMemberAdd)
+	session.AddHandler(guildMemberRemove)
 	session.AddHandler(messageCreate)
+	session.AddHandler(interactionCreate)
+
+	// Метрики Prometheus и проверки состояния, если задан HTTP_ADDR
+	healthChecks := handler.StartHTTPServer(session)
 
 	session.Identify.Intents = discordgo.IntentsGuildMessages |
 		discordgo.IntentsGuildMembers |
-		discordgo.IntentsGuilds
+		discordgo.IntentsGuilds |
+		discordgo.IntentsMessageContent
 
 	err = session.Open()
 	if err != nil {
@@ -127,8 +162,30 @@ func main() {
 	}
 	defer session.Close()
 
+	// Регистрируем слэш-команды
+	handler.RegisterSlashCommands(session)
+
+	// Восстанавливаем отложенные удаления и архивации каналов
+	if err := handler.RestoreScheduledTasks(session); err != nil {
+		Logger.Error("Ошибка восстановления отложенных задач: " + err.Error())
+	}
+
+	// Пересоздаём панели регистрации, удалённые пока бот был выключен
+	handler.RefreshPanels(session)
+
+	// Вместе с проверками состояния включаем сторож: если бот завис,
+	// он останавливается обычным путём, и Docker перезапускает его
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if healthChecks {
+		handler.StartWatchdog(ctx, session, cancel)
+	}
+
 	Logger.Info("Бот запущен! Для остановки Ctrl+C")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
+	select {
+	case <-sc:
+	case <-ctx.Done():
+	}
 }